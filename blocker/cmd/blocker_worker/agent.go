@@ -0,0 +1,36 @@
+package main
+
+import (
+	"blocker-worker/internal/agent"
+	"blocker-worker/internal/config"
+	"blocker-worker/internal/health"
+	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// runAgent запускает агента, отправляющего access.log Xray в observer, до сигнала завершения.
+// Состояние отправки доступно на том же HTTP-сервере проб и метрик, что и у блокировщика.
+func runAgent(l *logger.Logger, cfg *config.Config) error {
+	registry := metrics.NewRegistry()
+	logAgent, err := agent.New(l, cfg, metrics.NewAgent(registry))
+	if err != nil {
+		return err
+	}
+	healthServer := health.NewServer(l, cfg.HTTPListenAddr, registry, health.Check{Name: "shipping", Status: logAgent.ShippingStatus})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go healthServer.Run(ctx, &wg)
+
+	logAgent.Run(ctx)
+	wg.Wait()
+	return nil
+}
@@ -1,23 +1,199 @@
 package main
 
 import (
+	"blocker-worker/internal/agent"
+	"blocker-worker/internal/allowlist"
 	"blocker-worker/internal/config"
+	"blocker-worker/internal/health"
 	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
 	"blocker-worker/internal/processor"
 	"blocker-worker/internal/services/command"
+	"blocker-worker/internal/services/firewall"
+	"blocker-worker/internal/services/transport"
+	"blocker-worker/internal/signing"
 	"blocker-worker/internal/worker"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
 )
 
 func main() {
 	// 1. Инициализация зависимостей
 	l := logger.New()
 	cfg := config.New()
-	cmdExecutor := command.NewExecutor(l)
-	msgProcessor := processor.NewMessageProcessor(l, cmdExecutor)
 
-	// 2. Инициализация главного воркера
-	appWorker := worker.New(l, cfg, msgProcessor)
+	mode := ""
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
+	}
+
+	// Режим агента: только отправка access.log в observer, без доступа к файрволу.
+	if mode == "agent" {
+		if err := runAgent(l, cfg); err != nil {
+			l.Error(fmt.Sprintf("Критическая ошибка: %v", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	backend, err := newFirewallBackend(l, cfg)
+	if err != nil {
+		l.Error(fmt.Sprintf("Критическая ошибка: %v", err))
+		os.Exit(1)
+	}
+	l.Info(fmt.Sprintf("Используется бэкенд файрвола: %s", backend.Name()))
+
+	// Служебные команды для ручного управления blacklist: list, flush, unblock <ip>...
+	if mode != "" && mode != "node" {
+		if err := runCommand(backend, mode, os.Args[2:]); err != nil {
+			l.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.Transport != transport.RabbitMQ && cfg.Transport != transport.Redis {
+		l.Error(fmt.Sprintf("Критическая ошибка: неизвестный транспорт '%s' (доступны: %s, %s)", cfg.Transport, transport.RabbitMQ, transport.Redis))
+		os.Exit(1)
+	}
+	l.Info(fmt.Sprintf("Транспорт команд блокировки: %s", cfg.Transport))
+
+	allow, err := allowlist.New(cfg.AllowlistCIDRs)
+	if err != nil {
+		l.Error(fmt.Sprintf("Критическая ошибка: %v", err))
+		os.Exit(1)
+	}
+	l.Info(fmt.Sprintf("Локальный allowlist: частные, loopback и link-local диапазоны и %d адресов/подсетей (включая интерфейсы ноды)", allow.Len()))
+
+	registry := metrics.NewRegistry()
+	blockerMetrics := metrics.NewBlocker(registry)
+	msgProcessor := processor.NewMessageProcessor(l, cfg, backend, allow, blockerMetrics)
+
+	// 2. Инициализация главного воркера и HTTP-сервера проб и метрик
+	verifier, err := newVerifier(l, cfg)
+	if err != nil {
+		l.Error(fmt.Sprintf("Критическая ошибка: %v", err))
+		os.Exit(1)
+	}
+	appWorker := worker.New(l, cfg, msgProcessor, backend, verifier, blockerMetrics)
+	checks := []health.Check{{Name: "enforcing", Status: appWorker.EnforcingStatus}}
+
+	// В режиме node тот же процесс отправляет access.log в observer (вместо отдельного Vector).
+	var logAgent *agent.Agent
+	if mode == "node" {
+		logAgent, err = agent.New(l, cfg, metrics.NewAgent(registry))
+		if err != nil {
+			l.Error(fmt.Sprintf("Критическая ошибка: %v", err))
+			os.Exit(1)
+		}
+		checks = append([]health.Check{{Name: "shipping", Status: logAgent.ShippingStatus}}, checks...)
+	}
+	healthServer := health.NewServer(l, cfg.HTTPListenAddr, registry, checks...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go healthServer.Run(ctx, &wg)
+	if logAgent != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logAgent.Run(ctx)
+		}()
+	}
 
 	// 3. Запуск приложения
 	appWorker.Run()
-}
\ No newline at end of file
+
+	cancel()
+	wg.Wait()
+}
+
+// newFirewallBackend создает бэкенд файрвола, выбранный в конфигурации.
+func newFirewallBackend(l *logger.Logger, cfg *config.Config) (firewall.Backend, error) {
+	target := firewall.NftTarget{
+		Family: cfg.NftFamily,
+		Table:  cfg.NftTable,
+		SetV4:  cfg.NftSet,
+		SetV6:  cfg.NftSetV6,
+	}
+
+	switch cfg.FirewallBackend {
+	case firewall.BackendExec:
+		return firewall.NewExecBackend(command.NewExecutor(l), target)
+	case firewall.BackendNetlink:
+		return firewall.NewNetlinkBackend(l, target)
+	case firewall.BackendIPSet:
+		return firewall.NewIPSetBackend(command.NewExecutor(l), cfg.IPSetName, cfg.IPSetNameV6)
+	default:
+		return nil, fmt.Errorf("неизвестный бэкенд файрвола '%s'", cfg.FirewallBackend)
+	}
+}
+
+// newVerifier создает проверку подписей команд. Без COMMAND_PUBLIC_KEY проверка отключена.
+func newVerifier(l *logger.Logger, cfg *config.Config) (*signing.Verifier, error) {
+	if cfg.CommandPublicKey == "" {
+		l.Warning("COMMAND_PUBLIC_KEY не задан: подписи команд не проверяются, любой клиент брокера может блокировать IP.")
+		return nil, nil
+	}
+	verifier, err := signing.NewVerifier(cfg.CommandPublicKey, cfg.SignatureMaxAge, cfg.SignatureNonceFile)
+	if errors.Is(err, signing.ErrNonceFile) {
+		// Без журнала nonce повтор после перезапуска исключается отказом от команд,
+		// подписанных до запуска; пропущенные блокировки придут в снимке.
+		l.Warning(fmt.Sprintf("%v. Команды, подписанные до запуска блокировщика, будут пропущены.", err))
+		verifier, err = signing.NewVerifier(cfg.CommandPublicKey, cfg.SignatureMaxAge, "")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("некорректный COMMAND_PUBLIC_KEY: %w", err)
+	}
+	l.Info(fmt.Sprintf("Проверка подписей команд включена (максимальный возраст подписи %v).", cfg.SignatureMaxAge))
+	return verifier, nil
+}
+
+// runCommand выполняет служебную команду над blacklist и завершает работу.
+func runCommand(backend firewall.Backend, name string, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch name {
+	case "list":
+		entries, err := backend.List(ctx)
+		if err != nil {
+			return fmt.Errorf("не удалось получить blacklist: %w", err)
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s\t%v\n", entry.IP, entry.Timeout)
+		}
+		fmt.Printf("Всего: %d\n", len(entries))
+		return nil
+	case "flush":
+		if err := backend.Flush(ctx); err != nil {
+			return fmt.Errorf("не удалось очистить blacklist: %w", err)
+		}
+		fmt.Println("Blacklist очищен.")
+		return nil
+	case "unblock":
+		if len(args) == 0 {
+			return fmt.Errorf("использование: unblock <ip> [ip...]")
+		}
+		failed := 0
+		for _, res := range backend.Unblock(ctx, args) {
+			if res.Err != nil {
+				failed++
+				fmt.Printf("%s\tошибка: %v\n", res.IP, res.Err)
+				continue
+			}
+			fmt.Printf("%s\tразблокирован\n", res.IP)
+		}
+		if failed > 0 {
+			return fmt.Errorf("не удалось разблокировать %d из %d адресов", failed, len(args))
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда '%s' (доступны: node, agent, list, flush, unblock)", name)
+	}
+}
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"blocker-worker/internal/config"
+	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
+	"blocker-worker/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sendBackoffInitial = time.Second
+	sendBackoffMax     = 30 * time.Second
+	shutdownFlushLimit = 10 * time.Second
+)
+
+// Agent читает access.log Xray, разбирает строки и пакетами отправляет записи в observer.
+// Пакеты, которые не удалось доставить после нескольких попыток, сохраняются в спул на диске
+// и досылаются по порядку, когда observer снова доступен. Позиция в логе сохраняется
+// только после того, как прочитанные записи доставлены или сохранены в спул.
+type Agent struct {
+	logger  *logger.Logger
+	cfg     *config.Config
+	metrics *metrics.Agent
+	tailer  *Tailer
+	shipper *Shipper
+	spool   *Spool
+
+	shipping atomic.Bool
+}
+
+// New создает агента по конфигурации ноды.
+func New(l *logger.Logger, cfg *config.Config, m *metrics.Agent) (*Agent, error) {
+	if cfg.ObserverURL == "" {
+		return nil, errors.New("не задан OBSERVER_URL для отправки логов")
+	}
+	spool, err := NewSpool(filepath.Join(cfg.AgentStateDir, "spool"), cfg.AgentSpoolMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	shipper, err := NewShipper(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Agent{
+		logger:  l,
+		cfg:     cfg,
+		metrics: m,
+		tailer:  NewTailer(cfg.AccessLogPath, filepath.Join(cfg.AgentStateDir, "position.json")),
+		shipper: shipper,
+		spool:   spool,
+	}
+	a.shipping.Store(true)
+	m.SpoolBatches.Set(int64(spool.Len()))
+	return a, nil
+}
+
+// ShippingOK сообщает, доставляются ли записи в observer: последняя отправка прошла успешно
+// и спул пуст.
+func (a *Agent) ShippingOK() bool {
+	return a.shipping.Load()
+}
+
+// ShippingStatus возвращает состояние отправки для проверки готовности "shipping".
+func (a *Agent) ShippingStatus() (bool, string) {
+	if a.ShippingOK() {
+		return true, ""
+	}
+	return false, fmt.Sprintf("observer недоступен, в спуле %d пакетов", a.spool.Len())
+}
+
+// Run читает лог и отправляет записи до отмены контекста. При остановке накопленный
+// пакет отправляется или сохраняется в спул, а позиция в логе сохраняется.
+func (a *Agent) Run(ctx context.Context) {
+	a.logger.Info(fmt.Sprintf("Агент запущен (нода %s): %s -> %s", a.cfg.NodeID, a.cfg.AccessLogPath, a.cfg.ObserverURL))
+	defer a.tailer.Close()
+
+	ticker := time.NewTicker(a.cfg.AgentPollInterval)
+	defer ticker.Stop()
+
+	var batch []models.LogEntry
+	lastFlush := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushLimit)
+			a.flush(flushCtx, batch)
+			cancel()
+			a.logger.Info("Агент остановлен.")
+			return
+		case <-ticker.C:
+		}
+
+		batch = append(batch, a.read()...)
+		// Полные пакеты отправляются сразу; позиция сохраняется только вместе с остатком в flush.
+		for len(batch) >= a.cfg.AgentBatchSize {
+			a.ship(ctx, batch[:a.cfg.AgentBatchSize])
+			batch = batch[a.cfg.AgentBatchSize:]
+		}
+		if time.Since(lastFlush) < a.cfg.AgentFlushInterval {
+			continue
+		}
+		lastFlush = time.Now()
+		a.flush(ctx, batch)
+		batch = nil
+		a.drainSpool(ctx)
+	}
+}
+
+// read читает новые строки лога и разбирает их в записи.
+func (a *Agent) read() []models.LogEntry {
+	lines, err := a.tailer.ReadLines()
+	if err != nil {
+		a.logger.Warning(fmt.Sprintf("Ошибка чтения %s: %v", a.cfg.AccessLogPath, err))
+	}
+
+	now := time.Now()
+	entries := make([]models.LogEntry, 0, len(lines))
+	for _, line := range lines {
+		a.metrics.LinesRead.Inc()
+		entry, ok := ParseLine(line, now)
+		if !ok {
+			a.metrics.LinesSkipped.Inc()
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// flush доставляет пакет в observer (или в спул) и сохраняет позицию чтения.
+// Если спул не пуст, новый пакет ставится в его конец, чтобы сохранить порядок записей.
+func (a *Agent) flush(ctx context.Context, entries []models.LogEntry) {
+	if len(entries) > 0 {
+		a.ship(ctx, entries)
+	}
+	if err := a.tailer.Commit(); err != nil {
+		a.logger.Error(fmt.Sprintf("Не удалось сохранить позицию чтения лога: %v", err))
+	}
+}
+
+func (a *Agent) ship(ctx context.Context, entries []models.LogEntry) {
+	body, err := a.shipper.Encode(entries)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("Ошибка сериализации пакета из %d записей: %v", len(entries), err))
+		a.metrics.EntriesDropped.Add(len(entries))
+		return
+	}
+
+	if a.spool.Len() == 0 {
+		err = a.sendWithRetry(ctx, body)
+		if err == nil {
+			a.metrics.EntriesShipped.Add(len(entries))
+			return
+		}
+		if errors.Is(err, errRejected) {
+			a.logger.Error(fmt.Sprintf("Пакет из %d записей отброшен: %v", len(entries), err))
+			a.metrics.EntriesDropped.Add(len(entries))
+			return
+		}
+		a.logger.Warning(fmt.Sprintf("Observer недоступен: %v. Пакет из %d записей сохранен в спул.", err, len(entries)))
+	}
+
+	if err := a.spool.Put(body); err != nil {
+		a.logger.Error(fmt.Sprintf("Не удалось сохранить пакет из %d записей в спул: %v", len(entries), err))
+		a.metrics.EntriesDropped.Add(len(entries))
+		return
+	}
+	a.metrics.BatchesSpooled.Inc()
+	a.metrics.SpoolBatches.Set(int64(a.spool.Len()))
+	a.shipping.Store(false)
+}
+
+// sendWithRetry отправляет пакет с экспоненциальной паузой между попытками.
+func (a *Agent) sendWithRetry(ctx context.Context, body []byte) error {
+	backoff := sendBackoffInitial
+	var err error
+	for attempt := 1; attempt <= a.cfg.AgentSendRetries; attempt++ {
+		if err = a.send(ctx, body); err == nil || errors.Is(err, errRejected) {
+			return err
+		}
+		if attempt == a.cfg.AgentSendRetries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > sendBackoffMax {
+			backoff = sendBackoffMax
+		}
+	}
+	return err
+}
+
+// send выполняет одну попытку отправки и обновляет метрики.
+func (a *Agent) send(ctx context.Context, body []byte) error {
+	err := a.shipper.Send(ctx, body)
+	if err != nil {
+		a.metrics.SendErrors.Inc()
+		a.shipping.Store(false)
+		return err
+	}
+	a.metrics.BatchesSent.Inc()
+	a.metrics.LastShipSuccess.Set(time.Now().Unix())
+	a.shipping.Store(true)
+	return nil
+}
+
+// drainSpool досылает пакеты из спула. Отклоненные observer пакеты удаляются.
+func (a *Agent) drainSpool(ctx context.Context) {
+	if a.spool.Len() == 0 {
+		return
+	}
+	sent, err := a.spool.Drain(func(body []byte) error {
+		err := a.send(ctx, body)
+		if errors.Is(err, errRejected) {
+			a.logger.Error(fmt.Sprintf("Пакет из спула отброшен: %v", err))
+			return nil
+		}
+		return err
+	})
+	a.metrics.SpoolBatches.Set(int64(a.spool.Len()))
+	if sent > 0 {
+		a.logger.Info(fmt.Sprintf("Из спула доставлено пакетов: %d, осталось: %d.", sent, a.spool.Len()))
+	}
+	if err != nil {
+		a.logger.Warning(fmt.Sprintf("Observer все еще недоступен, в спуле %d пакетов: %v", a.spool.Len(), err))
+		a.shipping.Store(false)
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"blocker-worker/internal/models"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Формат времени в начале строки access.log Xray.
+const xrayTimeLayout = "2006/01/02 15:04:05.999999"
+
+// ParseLine разбирает строку access.log Xray и извлекает адрес клиента и email пользователя.
+// Поддерживаются IPv4 и IPv6 (в квадратных скобках), с префиксом сети и без него, например:
+//
+//	2025/01/02 15:04:05.123456 from 203.0.113.7:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com
+//	2025/01/02 15:04:05 from tcp:[2001:db8::1]:51234 accepted udp:1.1.1.1:53 [in >> out] email: 42
+//
+// Строки без адреса клиента или email (служебные сообщения, unix-сокеты) возвращают ok == false.
+// IPv4-mapped IPv6 приводится к IPv4; если время в строке не разобрано, используется now.
+func ParseLine(line string, now time.Time) (entry models.LogEntry, ok bool) {
+	fromIdx := strings.Index(line, " from ")
+	if fromIdx < 0 {
+		return entry, false
+	}
+	rest := line[fromIdx+len(" from "):]
+	source, _, _ := strings.Cut(rest, " ")
+
+	ip, ok := parseSource(source)
+	if !ok {
+		return entry, false
+	}
+
+	emailIdx := strings.LastIndex(rest, " email: ")
+	if emailIdx < 0 {
+		return entry, false
+	}
+	email, _, _ := strings.Cut(strings.TrimSpace(rest[emailIdx+len(" email: "):]), " ")
+	if email == "" {
+		return entry, false
+	}
+
+	entry = models.LogEntry{UserEmail: email, SourceIP: ip, Timestamp: now}
+	if ts, err := time.ParseInLocation(xrayTimeLayout, strings.TrimSpace(line[:fromIdx]), time.Local); err == nil {
+		entry.Timestamp = ts
+	}
+	return entry, true
+}
+
+// parseSource разбирает адрес источника вида [tcp:|udp:]host:port и возвращает канонический IP.
+func parseSource(source string) (string, bool) {
+	if network, addr, found := strings.Cut(source, ":"); found && (network == "tcp" || network == "udp") {
+		source = addr
+	}
+
+	var host string
+	if strings.HasPrefix(source, "[") {
+		end := strings.Index(source, "]")
+		if end < 0 {
+			return "", false
+		}
+		host = source[1:end]
+	} else {
+		idx := strings.LastIndex(source, ":")
+		if idx < 0 {
+			return "", false
+		}
+		host = source[:idx]
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil || ip.Zone() != "" {
+		return "", false
+	}
+	return ip.Unmap().String(), true
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// accessLogFixture — пример строки access.log Xray. Одни и те же примеры в testdata/ проверяют
+// разбор и в блокировщике, и в observer (прием по syslog), чтобы парсеры не расходились.
+type accessLogFixture struct {
+	Name  string `json:"name"`
+	Line  string `json:"line"`
+	OK    bool   `json:"ok"`
+	IP    string `json:"ip"`
+	Email string `json:"email"`
+}
+
+func loadAccessLogFixtures(t *testing.T) []accessLogFixture {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", "testdata", "xray_access_log.json"))
+	if err != nil {
+		t.Fatalf("не удалось прочитать примеры access.log: %v", err)
+	}
+	var fixtures []accessLogFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatalf("некорректный файл примеров access.log: %v", err)
+	}
+	return fixtures
+}
+
+func TestParseLine(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range loadAccessLogFixtures(t) {
+		t.Run(tt.Name, func(t *testing.T) {
+			entry, ok := ParseLine(tt.Line, now)
+			if ok != tt.OK {
+				t.Fatalf("ok = %v, ожидалось %v (запись %+v)", ok, tt.OK, entry)
+			}
+			if ok && (entry.SourceIP != tt.IP || entry.UserEmail != tt.Email) {
+				t.Errorf("получено {ip=%s email=%s}, ожидалось {ip=%s email=%s}",
+					entry.SourceIP, entry.UserEmail, tt.IP, tt.Email)
+			}
+		})
+	}
+}
+
+func TestParseLineTimestamp(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		line string
+		ts   time.Time
+	}{
+		{
+			name: "время с микросекундами",
+			line: "2025/01/02 15:04:05.123456 from 203.0.113.7:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com",
+			ts:   time.Date(2025, 1, 2, 15, 4, 5, 123456000, time.Local),
+		},
+		{
+			name: "время без долей секунды",
+			line: "2025/01/02 15:04:05 from 203.0.113.7:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com",
+			ts:   time.Date(2025, 1, 2, 15, 4, 5, 0, time.Local),
+		},
+		{
+			name: "время не разобрано",
+			line: "garbage from 203.0.113.7:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com",
+			ts:   now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := ParseLine(tt.line, now)
+			if !ok {
+				t.Fatal("строка не разобрана")
+			}
+			if !entry.Timestamp.Equal(tt.ts) {
+				t.Errorf("время %v, ожидалось %v", entry.Timestamp, tt.ts)
+			}
+		})
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		source string
+		ip     string
+		ok     bool
+	}{
+		{"203.0.113.7:51234", "203.0.113.7", true},
+		{"tcp:203.0.113.7:51234", "203.0.113.7", true},
+		{"udp:203.0.113.7:53", "203.0.113.7", true},
+		{"[2001:db8::1]:443", "2001:db8::1", true},
+		{"tcp:[2001:DB8:0:0::1]:443", "2001:db8::1", true},
+		{"[::ffff:192.0.2.5]:443", "192.0.2.5", true},
+		{"[fe80::1%eth0]:443", "", false},
+		{"[2001:db8::1", "", false},
+		{"203.0.113.7", "", false},
+		{"example.com:443", "", false},
+		{"unix:/run/xray/xray.sock", "", false},
+		{"@xray", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		ip, ok := parseSource(tt.source)
+		if ip != tt.ip || ok != tt.ok {
+			t.Errorf("parseSource(%q) = %q, %v; ожидалось %q, %v", tt.source, ip, ok, tt.ip, tt.ok)
+		}
+	}
+}
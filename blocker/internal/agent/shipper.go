@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"blocker-worker/internal/config"
+	"blocker-worker/internal/models"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errRejected означает, что observer окончательно отклонил пакет (4xx): повтор не поможет.
+var errRejected = errors.New("observer отклонил пакет")
+
+// Shipper отправляет пакеты записей в ingest-эндпоинт observer.
+type Shipper struct {
+	url      string
+	nodeID   string
+	token    string
+	compress bool
+	client   *http.Client
+}
+
+// NewShipper создает отправителя для OBSERVER_URL. Пакеты помечаются идентификатором ноды
+// в заголовке X-Node-ID; с AGENT_GZIP тело сжимается gzip. Нода подтверждает себя токеном
+// AGENT_TOKEN (Authorization: Bearer) и/или клиентским сертификатом AGENT_TLS_CERT_FILE.
+func NewShipper(cfg *config.Config) (*Shipper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.AgentTLSCertFile != "" || cfg.AgentTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.AgentTLSCertFile, cfg.AgentTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось загрузить клиентский сертификат агента: %w", err)
+		}
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Shipper{
+		url:      cfg.ObserverURL,
+		nodeID:   cfg.NodeID,
+		token:    cfg.AgentToken,
+		compress: cfg.AgentCompress,
+		client:   &http.Client{Timeout: cfg.AgentRequestTimeout, Transport: transport},
+	}, nil
+}
+
+// Encode сериализует записи в JSON-массив и при необходимости сжимает его gzip.
+func (s *Shipper) Encode(entries []models.LogEntry) ([]byte, error) {
+	if !s.compress {
+		return json.Marshal(entries)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(entries); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send отправляет подготовленное Encode тело. Ошибка, обернутая в errRejected,
+// означает, что пакет некорректен и повторять его не нужно.
+func (s *Shipper) Send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Node-ID", s.nodeID)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if s.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки пакета: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("observer временно недоступен: %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	default:
+		return fmt.Errorf("%w: %s: %s", errRejected, resp.Status, bytes.TrimSpace(respBody))
+	}
+}
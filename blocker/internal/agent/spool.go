@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const spoolSuffix = ".batch"
+
+// Spool хранит на диске пакеты, которые не удалось отправить, пока observer недоступен.
+// Каждый пакет — отдельный файл; при превышении maxBytes удаляются самые старые пакеты.
+type Spool struct {
+	dir      string
+	maxBytes int64
+}
+
+// NewSpool создает спул в каталоге dir.
+func NewSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать каталог спула: %w", err)
+	}
+	return &Spool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Put сохраняет подготовленное тело запроса. Запись атомарна: файл появляется целиком.
+func (s *Spool) Put(body []byte) error {
+	name := fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolSuffix)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("не удалось записать пакет в спул: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("не удалось записать пакет в спул: %w", err)
+	}
+	return s.trim()
+}
+
+// Drain отправляет сохраненные пакеты от старых к новым и удаляет отправленные.
+// Останавливается на первой ошибке отправки, чтобы сохранить порядок.
+// Возвращает число отправленных пакетов.
+func (s *Spool) Drain(send func(body []byte) error) (int, error) {
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, name := range files {
+		path := filepath.Join(s.dir, name)
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return sent, fmt.Errorf("не удалось прочитать пакет из спула: %w", err)
+		}
+		if err := send(body); err != nil {
+			return sent, err
+		}
+		if err := os.Remove(path); err != nil {
+			return sent, fmt.Errorf("не удалось удалить отправленный пакет из спула: %w", err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Len возвращает число пакетов в спуле.
+func (s *Spool) Len() int {
+	files, _ := s.files()
+	return len(files)
+}
+
+// trim удаляет самые старые пакеты, пока размер спула превышает лимит.
+func (s *Spool) trim() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, name := range files {
+		if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > s.maxBytes && i < len(files)-1; i++ {
+		if err := os.Remove(filepath.Join(s.dir, files[i])); err != nil {
+			return err
+		}
+		total -= sizes[i]
+	}
+	return nil
+}
+
+// files возвращает имена пакетов, отсортированные от старых к новым.
+func (s *Spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать каталог спула: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolSuffix) {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
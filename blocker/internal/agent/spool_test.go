@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestSpool(t *testing.T, maxBytes int64) *Spool {
+	t.Helper()
+	spool, err := NewSpool(t.TempDir(), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spool
+}
+
+// drainAll выгружает спул и возвращает тела пакетов в порядке отправки.
+func drainAll(t *testing.T, spool *Spool) []string {
+	t.Helper()
+	var bodies []string
+	if _, err := spool.Drain(func(body []byte) error {
+		bodies = append(bodies, string(body))
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	return bodies
+}
+
+func TestSpoolRoundTrip(t *testing.T) {
+	spool := newTestSpool(t, 1<<20)
+	want := []string{"batch-1", "batch-2", "batch-3"}
+	for _, body := range want {
+		if err := spool.Put([]byte(body)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if n := spool.Len(); n != len(want) {
+		t.Fatalf("Len = %d, ожидалось %d", n, len(want))
+	}
+
+	if got := drainAll(t, spool); !reflect.DeepEqual(got, want) {
+		t.Fatalf("выгружено %q, ожидалось %q", got, want)
+	}
+	if n := spool.Len(); n != 0 {
+		t.Fatalf("после выгрузки в спуле осталось %d пакетов", n)
+	}
+}
+
+func TestSpoolDrainStopsOnError(t *testing.T) {
+	spool := newTestSpool(t, 1<<20)
+	for _, body := range []string{"batch-1", "batch-2", "batch-3"} {
+		if err := spool.Put([]byte(body)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	errUnavailable := errors.New("observer недоступен")
+	sent, err := spool.Drain(func(body []byte) error {
+		if string(body) == "batch-2" {
+			return errUnavailable
+		}
+		return nil
+	})
+	if sent != 1 || !errors.Is(err, errUnavailable) {
+		t.Fatalf("Drain = %d, %v; ожидалось 1, %v", sent, err, errUnavailable)
+	}
+
+	// Неотправленные пакеты остаются и выгружаются в прежнем порядке.
+	if got, want := drainAll(t, spool), []string{"batch-2", "batch-3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("выгружено %q, ожидалось %q", got, want)
+	}
+}
+
+func TestSpoolTrimsOldest(t *testing.T) {
+	spool := newTestSpool(t, 11)
+	for _, body := range []string{"old-1", "old-2", "newest"} {
+		if err := spool.Put([]byte(body)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	if got, want := drainAll(t, spool), []string{"old-2", "newest"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("выгружено %q, ожидалось %q", got, want)
+	}
+}
+
+func TestSpoolKeepsNewestOverLimit(t *testing.T) {
+	spool := newTestSpool(t, 4)
+	for _, body := range []string{"first", "second"} {
+		if err := spool.Put([]byte(body)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	// Самый новый пакет сохраняется, даже если один превышает лимит.
+	if got, want := drainAll(t, spool), []string{"second"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("выгружено %q, ожидалось %q", got, want)
+	}
+}
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// maxLineLength ограничивает длину строки; более длинные строки отбрасываются целиком.
+const maxLineLength = 64 * 1024
+
+// position — сохраняемая позиция чтения: идентификатор файла (устройство и inode) и смещение в нем.
+type position struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// Tailer читает новые строки из файла лога, переживая ротацию (переименование с созданием
+// нового файла) и усечение (copytruncate). Позиция сохраняется в файл состояния и
+// восстанавливается после перезапуска.
+type Tailer struct {
+	path      string
+	stateFile string
+
+	file    *os.File
+	pos     position
+	partial []byte
+	skip    bool
+}
+
+// NewTailer создает Tailer. Без сохраненной позиции чтение начинается с конца файла,
+// чтобы не отправлять старые записи при первом запуске.
+func NewTailer(path, stateFile string) *Tailer {
+	return &Tailer{path: path, stateFile: stateFile}
+}
+
+// ReadLines возвращает полные строки, дописанные с прошлого вызова. Незавершенная последняя
+// строка остается в буфере до следующего вызова. Если файла пока нет, возвращает пустой результат.
+func (t *Tailer) ReadLines() ([]string, error) {
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	lines, err := t.readAvailable()
+	if err != nil {
+		return lines, err
+	}
+
+	// Файл по пути заменен (ротация): старый дочитан, переходим на новый с начала.
+	rotated, err := t.rotated()
+	if err != nil || !rotated {
+		return lines, err
+	}
+	t.file.Close()
+	t.file = nil
+	t.partial = nil
+	t.skip = false
+	if err := t.open(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lines, nil
+		}
+		return lines, err
+	}
+	t.pos.Offset = 0
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return lines, err
+	}
+	more, err := t.readAvailable()
+	return append(lines, more...), err
+}
+
+// open открывает файл и определяет начальную позицию по сохраненному состоянию.
+func (t *Tailer) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	device, inode := fileID(info)
+
+	saved, hasSaved := t.loadPosition()
+	offset := info.Size()
+	switch {
+	case hasSaved && saved.Device == device && saved.Inode == inode && saved.Offset <= info.Size():
+		offset = saved.Offset
+	case hasSaved:
+		// Файл сменился, пока агент не работал: читаем новый файл целиком.
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	t.file = f
+	t.pos = position{Device: device, Inode: inode, Offset: offset}
+	return nil
+}
+
+// readAvailable читает все доступные данные из текущего файла, обрабатывая усечение.
+func (t *Tailer) readAvailable() ([]string, error) {
+	info, err := t.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < t.pos.Offset {
+		// Файл усечен на месте (copytruncate): начинаем сначала.
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		t.pos.Offset = 0
+		t.partial = nil
+		t.skip = false
+	}
+
+	var lines []string
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := t.file.Read(buf)
+		if n > 0 {
+			t.pos.Offset += int64(n)
+			lines = t.split(lines, buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// split дополняет буфер незавершенной строки и выделяет из него полные строки.
+func (t *Tailer) split(lines []string, data []byte) []string {
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			t.appendPartial(data)
+			return lines
+		}
+		t.appendPartial(data[:idx])
+		if !t.skip {
+			lines = append(lines, string(bytes.TrimRight(t.partial, "\r")))
+		}
+		t.partial = t.partial[:0]
+		t.skip = false
+		data = data[idx+1:]
+	}
+	return lines
+}
+
+func (t *Tailer) appendPartial(data []byte) {
+	if t.skip {
+		return
+	}
+	if len(t.partial)+len(data) > maxLineLength {
+		t.partial = t.partial[:0]
+		t.skip = true
+		return
+	}
+	t.partial = append(t.partial, data...)
+}
+
+// rotated сообщает, указывает ли путь на другой файл, чем открытый.
+func (t *Tailer) rotated() (bool, error) {
+	info, err := os.Stat(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	device, inode := fileID(info)
+	return device != t.pos.Device || inode != t.pos.Inode, nil
+}
+
+// Commit сохраняет позицию конца последней полной прочитанной строки.
+// Вызывается после того, как прочитанные записи переданы observer или сохранены в спул.
+func (t *Tailer) Commit() error {
+	if t.file == nil {
+		return nil
+	}
+	pos := t.pos
+	pos.Offset -= int64(len(t.partial))
+	if t.skip {
+		pos.Offset = t.pos.Offset
+	}
+
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.stateFile), 0o755); err != nil {
+		return fmt.Errorf("не удалось создать каталог состояния: %w", err)
+	}
+	tmp := t.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("не удалось сохранить позицию чтения: %w", err)
+	}
+	return os.Rename(tmp, t.stateFile)
+}
+
+// Close закрывает файл лога.
+func (t *Tailer) Close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+func (t *Tailer) loadPosition() (position, bool) {
+	data, err := os.ReadFile(t.stateFile)
+	if err != nil {
+		return position{}, false
+	}
+	var pos position
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return position{}, false
+	}
+	return pos, true
+}
+
+// fileID возвращает устройство и inode файла, по которым определяется ротация.
+func fileID(info os.FileInfo) (uint64, uint64) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), stat.Ino
+	}
+	return 0, 0
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestTailer создает файл лога с содержимым initial и Tailer, уже открывший его.
+func newTestTailer(t *testing.T, initial string) (*Tailer, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	state := filepath.Join(dir, "state", "position.json")
+	writeFile(t, path, initial)
+
+	tailer := NewTailer(path, state)
+	t.Cleanup(tailer.Close)
+	expectLines(t, tailer)
+	return tailer, path, state
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectLines читает строки и сравнивает их с ожидаемыми.
+func expectLines(t *testing.T, tailer *Tailer, want ...string) {
+	t.Helper()
+	lines, err := tailer.ReadLines()
+	if err != nil {
+		t.Fatalf("ReadLines: %v", err)
+	}
+	if len(lines) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("прочитано %q, ожидалось %q", lines, want)
+	}
+}
+
+func TestTailerStartsAtEnd(t *testing.T) {
+	tailer, path, _ := newTestTailer(t, "old-1\nold-2\n")
+
+	appendFile(t, path, "new-1\nnew-")
+	expectLines(t, tailer, "new-1")
+	appendFile(t, path, "2\r\n")
+	expectLines(t, tailer, "new-2")
+	expectLines(t, tailer)
+}
+
+func TestTailerMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	tailer := NewTailer(filepath.Join(dir, "access.log"), filepath.Join(dir, "position.json"))
+	defer tailer.Close()
+	expectLines(t, tailer)
+}
+
+func TestTailerRenameRotation(t *testing.T) {
+	tailer, path, _ := newTestTailer(t, "old\n")
+
+	appendFile(t, path, "before-rotation\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "after-rotation\n")
+
+	// Старый файл дочитывается, затем новый читается с начала.
+	expectLines(t, tailer, "before-rotation", "after-rotation")
+	appendFile(t, path, "next\n")
+	expectLines(t, tailer, "next")
+}
+
+func TestTailerCopyTruncate(t *testing.T) {
+	tailer, path, _ := newTestTailer(t, "")
+
+	appendFile(t, path, "first-line\nsecond-line\n")
+	expectLines(t, tailer, "first-line", "second-line")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "third\n")
+	expectLines(t, tailer, "third")
+}
+
+func TestTailerRestartFromCommittedOffset(t *testing.T) {
+	tailer, path, state := newTestTailer(t, "old\n")
+
+	appendFile(t, path, "a\nb\npart")
+	expectLines(t, tailer, "a", "b")
+	if err := tailer.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// Прочитанные, но не подтвержденные строки после перезапуска читаются снова.
+	appendFile(t, path, "ial\nc\n")
+	expectLines(t, tailer, "partial", "c")
+	tailer.Close()
+
+	restarted := NewTailer(path, state)
+	defer restarted.Close()
+	expectLines(t, restarted, "partial", "c")
+}
+
+func TestTailerRestartAfterRotation(t *testing.T) {
+	tailer, path, state := newTestTailer(t, "old\n")
+	if err := tailer.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	tailer.Close()
+
+	// Пока агент не работал, файл ротирован: новый файл читается целиком.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "rotated-1\nrotated-2\n")
+
+	restarted := NewTailer(path, state)
+	defer restarted.Close()
+	expectLines(t, restarted, "rotated-1", "rotated-2")
+}
+
+func TestTailerDropsOverlongLines(t *testing.T) {
+	tailer, path, _ := newTestTailer(t, "")
+
+	appendFile(t, path, strings.Repeat("x", maxLineLength+10)+"\nshort\n")
+	expectLines(t, tailer, "short")
+
+	// Длинная строка, дописываемая частями, тоже отбрасывается целиком.
+	appendFile(t, path, strings.Repeat("y", maxLineLength))
+	expectLines(t, tailer)
+	appendFile(t, path, "yyyy\nafter\n")
+	expectLines(t, tailer, "after")
+
+	exact := strings.Repeat("z", maxLineLength)
+	appendFile(t, path, exact+"\n")
+	expectLines(t, tailer, exact)
+}
@@ -0,0 +1,90 @@
+package allowlist
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Allowlist — локальный список адресов, которые блокировщик никогда не добавляет в blacklist,
+// независимо от содержимого команды. Всегда включает частные, loopback и link-local диапазоны
+// и адреса интерфейсов самой ноды.
+type Allowlist struct {
+	prefixes []netip.Prefix
+}
+
+// New создает allowlist из CIDR (или одиночных адресов) конфигурации и адресов интерфейсов ноды.
+func New(cidrs []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, cidr := range cidrs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		a.prefixes = append(a.prefixes, prefix)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить адреса интерфейсов ноды: %w", err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(ipNet.IP); ok {
+			ip = ip.Unmap()
+			a.prefixes = append(a.prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		}
+	}
+	return a, nil
+}
+
+// Contains сообщает, защищен ли адрес от блокировки. Нераспознанные адреса не считаются защищенными:
+// их отклонит проверка команды или бэкенд файрвола.
+func (a *Allowlist) Contains(value string) bool {
+	ip, err := netip.ParseAddr(value)
+	if err != nil {
+		return false
+	}
+	return a.ContainsAddr(ip)
+}
+
+// ContainsAddr сообщает, защищен ли разобранный адрес от блокировки.
+func (a *Allowlist) ContainsAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len возвращает число явно заданных диапазонов, включая адреса интерфейсов.
+func (a *Allowlist) Len() int {
+	return len(a.prefixes)
+}
+
+// parsePrefix разбирает CIDR или одиночный адрес.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		ip, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("некорректный адрес в allowlist '%s': %w", value, err)
+		}
+		ip = ip.Unmap()
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("некорректный CIDR в allowlist '%s': %w", value, err)
+	}
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,113 @@
+package health
+
+import (
+	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Check — проверка готовности одной подсистемы ноды (например, enforcing или shipping).
+// Status возвращает признак готовности и, если она не готова, краткую причину.
+type Check struct {
+	Name   string
+	Status func() (ok bool, detail string)
+}
+
+// Server — HTTP-сервер с пробами живости/готовности и метриками.
+type Server struct {
+	logger   *logger.Logger
+	checks   []Check
+	registry *metrics.Registry
+	server   *http.Server
+}
+
+// NewServer создает HTTP-сервер на указанном адресе. Готовность ноды — это готовность всех checks.
+func NewServer(l *logger.Logger, addr string, registry *metrics.Registry, checks ...Check) *Server {
+	s := &Server{
+		logger:   l,
+		checks:   checks,
+		registry: registry,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/status", s.handleReadyz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Run запускает сервер и останавливает его при отмене контекста.
+func (s *Server) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warning(fmt.Sprintf("Ошибка при остановке HTTP-сервера: %v", err))
+		}
+	}()
+
+	s.logger.Info(fmt.Sprintf("HTTP-сервер проб и метрик запущен на %s", s.server.Addr))
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error(fmt.Sprintf("HTTP-сервер проб и метрик остановлен с ошибкой: %v", err))
+	}
+}
+
+// handleHealthz отвечает 200, пока процесс жив.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeText(w, http.StatusOK, "ok\n")
+}
+
+// handleReadyz отвечает 200, только если готовы все подсистемы, и перечисляет их состояние,
+// например "shipping OK, enforcing OK".
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready := true
+	parts := make([]string, 0, len(s.checks))
+	for _, check := range s.checks {
+		ok, detail := check.Status()
+		if ok {
+			parts = append(parts, check.Name+" OK")
+			continue
+		}
+		ready = false
+		parts = append(parts, fmt.Sprintf("%s FAILING (%s)", check.Name, detail))
+	}
+
+	body := strings.Join(parts, ", ") + "\n"
+	if ready {
+		writeText(w, http.StatusOK, body)
+		return
+	}
+	writeText(w, http.StatusServiceUnavailable, body)
+}
+
+// handleMetrics отдает метрики в текстовом формате Prometheus.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := s.registry.WriteTo(w); err != nil {
+		s.logger.Warning(fmt.Sprintf("Не удалось отдать метрики: %v", err))
+	}
+}
+
+func writeText(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(body))
+}
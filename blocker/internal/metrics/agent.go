@@ -0,0 +1,29 @@
+package metrics
+
+// Agent содержит метрики агента, отправляющего access.log в observer.
+type Agent struct {
+	LinesRead       *Counter
+	LinesSkipped    *Counter
+	EntriesShipped  *Counter
+	EntriesDropped  *Counter
+	BatchesSent     *Counter
+	BatchesSpooled  *Counter
+	SendErrors      *Counter
+	SpoolBatches    *Gauge
+	LastShipSuccess *Gauge
+}
+
+// NewAgent регистрирует метрики агента в реестре r.
+func NewAgent(r *Registry) *Agent {
+	return &Agent{
+		LinesRead:       r.Counter("agent_lines_read_total", "Lines read from the Xray access log."),
+		LinesSkipped:    r.Counter("agent_lines_skipped_total", "Lines without a client address or user email."),
+		EntriesShipped:  r.Counter("agent_entries_shipped_total", "Log entries accepted by the observer."),
+		EntriesDropped:  r.Counter("agent_entries_dropped_total", "Log entries rejected by the observer and dropped."),
+		BatchesSent:     r.Counter("agent_batches_sent_total", "Batches delivered to the observer, including spooled ones."),
+		BatchesSpooled:  r.Counter("agent_batches_spooled_total", "Batches written to the disk spool while the observer was unavailable."),
+		SendErrors:      r.Counter("agent_send_errors_total", "Failed attempts to deliver a batch to the observer."),
+		SpoolBatches:    r.Gauge("agent_spool_batches", "Batches waiting in the disk spool."),
+		LastShipSuccess: r.Gauge("agent_last_success_timestamp_seconds", "Unix time of the last successful delivery to the observer."),
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+// Blocker содержит метрики блокировщика.
+type Blocker struct {
+	MessagesReceived *Counter
+	MessagesAcked    *Counter
+	MessagesNacked   *Counter
+	MessagesRetried  *Counter
+	MessagesRejected *Counter
+	MessagesExpired  *Counter
+	IPsApplied       *Counter
+	IPsFailed        *Counter
+	IPsRefused       *Counter
+	FirewallLatency  *Histogram
+	Reconnects       *Counter
+	BlacklistSize    *Gauge
+}
+
+// NewBlocker регистрирует метрики блокировщика в реестре r.
+func NewBlocker(r *Registry) *Blocker {
+	return &Blocker{
+		MessagesReceived: r.Counter("blocker_messages_received_total", "Block commands received from the broker."),
+		MessagesAcked:    r.Counter("blocker_messages_acked_total", "Block commands acknowledged after processing."),
+		MessagesNacked:   r.Counter("blocker_messages_nacked_total", "Block commands rejected to the dead-letter exchange."),
+		MessagesRetried:  r.Counter("blocker_messages_retried_total", "Block commands deferred to the retry queue."),
+		MessagesRejected: r.Counter("blocker_messages_rejected_total", "Messages rejected because of a missing, invalid or replayed signature."),
+		MessagesExpired:  r.Counter("blocker_messages_expired_total", "Authentic block commands acknowledged without applying because their signature is older than SIGNATURE_MAX_AGE_SECONDS."),
+		IPsApplied:       r.Counter("blocker_ips_applied_total", "IP addresses successfully applied to the firewall."),
+		IPsFailed:        r.Counter("blocker_ips_failed_total", "IP addresses the firewall backend failed to apply."),
+		IPsRefused:       r.Counter("blocker_ips_refused_total", "IP addresses refused because they match the local allowlist."),
+		FirewallLatency: r.Histogram("blocker_firewall_operation_seconds", "Latency of firewall backend operations.",
+			0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5),
+		Reconnects:    r.Counter("blocker_broker_reconnects_total", "Reconnect attempts to the message broker."),
+		BlacklistSize: r.Gauge("blocker_blacklist_size", "Current number of entries in the firewall blacklist."),
+	}
+}
@@ -1,7 +1,54 @@
 package models
 
+import "time"
+
 // BlockingPayload представляет структуру входящих сообщений из RabbitMQ.
 type BlockingPayload struct {
+	BlockID  string   `json:"block_id"`
 	IPs      []string `json:"ips"`
 	Duration string   `json:"duration"`
-}
\ No newline at end of file
+}
+
+// BlockResult описывает результат применения команды блокировки на ноде.
+// Публикуется обратно в observer после обработки каждого сообщения.
+type BlockResult struct {
+	BlockID     string    `json:"block_id"`
+	NodeID      string    `json:"node_id"`
+	AppliedIPs  []string  `json:"applied_ips"`
+	FailedIPs   []string  `json:"failed_ips"`
+	RefusedIPs  []string  `json:"refused_ips,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// ActiveBlock описывает IP-адрес, который должен оставаться заблокированным до ExpiresAt.
+type ActiveBlock struct {
+	IP        string    `json:"ip"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BlockSnapshot представляет снимок активных блокировок, полученный от observer.
+type BlockSnapshot struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Blocks      []ActiveBlock `json:"blocks"`
+}
+
+// SnapshotRequest — запрос снимка блокировок через Redis: observer отвечает в список ReplyTo.
+type SnapshotRequest struct {
+	NodeID  string `json:"node_id"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// SnapshotReply — ответ observer на запрос снимка через Redis.
+// Body передается строкой без изменений, чтобы подпись в Headers оставалась проверяемой.
+type SnapshotReply struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// LogEntry — запись о подключении пользователя, которую агент отправляет в observer.
+type LogEntry struct {
+	UserEmail string    `json:"user_email"`
+	SourceIP  string    `json:"source_ip"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -1,67 +1,194 @@
 package processor
 
 import (
+	"blocker-worker/internal/allowlist"
+	"blocker-worker/internal/config"
 	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
 	"blocker-worker/internal/models"
-	"blocker-worker/internal/services/command"
+	"blocker-worker/internal/services/firewall"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"regexp"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var validDurationPattern = regexp.MustCompile(`^\d+[smhd]$`)
+const defaultDuration = "5m"
+
+var validDurationPattern = regexp.MustCompile(`^(\d+)([smhd])$`)
+
+// ErrInvalidPayload означает, что сообщение некорректно и повторная обработка не поможет.
+var ErrInvalidPayload = errors.New("некорректное сообщение о блокировке")
 
 // MessageProcessor инкапсулирует логику обработки одного сообщения RabbitMQ.
 type MessageProcessor struct {
-	logger   *logger.Logger
-	executor *command.Executor
+	logger    *logger.Logger
+	cfg       *config.Config
+	backend   firewall.Backend
+	allowlist *allowlist.Allowlist
+	metrics   *metrics.Blocker
 }
 
 // NewMessageProcessor создает новый обработчик сообщений.
-func NewMessageProcessor(l *logger.Logger, exec *command.Executor) *MessageProcessor {
+func NewMessageProcessor(l *logger.Logger, cfg *config.Config, backend firewall.Backend, allow *allowlist.Allowlist, m *metrics.Blocker) *MessageProcessor {
 	return &MessageProcessor{
-		logger:   l,
-		executor: exec,
+		logger:    l,
+		cfg:       cfg,
+		backend:   backend,
+		allowlist: allow,
+		metrics:   m,
 	}
 }
 
 // Process принимает тело сообщения и выполняет действие по блокировке.
-func (p *MessageProcessor) Process(ctx context.Context, body []byte) error {
-	var payload models.BlockingPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
-		p.logger.Error(fmt.Sprintf("Не удалось декодировать JSON из сообщения: %s", string(body)))
-		return err
+// Возвращает результат применения по каждому IP; ошибка ValidationErrors (errors.Is(err, ErrInvalidPayload))
+// означает, что сообщение некорректно и до файрвола не дошло.
+func (p *MessageProcessor) Process(ctx context.Context, body []byte) (*models.BlockResult, error) {
+	payload, err := decodePayload(body)
+	if err == nil {
+		var cmd *command
+		if cmd, err = p.validate(payload); err == nil {
+			return p.execute(ctx, cmd), nil
+		}
 	}
+	p.logger.Error(fmt.Sprintf("Сообщение о блокировке отклонено: %v", err))
+	return nil, err
+}
 
-	if len(payload.IPs) == 0 {
+// execute применяет проверенную команду к blacklist.
+func (p *MessageProcessor) execute(ctx context.Context, cmd *command) *models.BlockResult {
+	if len(cmd.IPs) == 0 {
 		p.logger.Info("Сообщение не содержит IP-адресов для блокировки, пропускаем.")
-		return nil
+		return p.apply(ctx, cmd.BlockID, nil)
+	}
+
+	entries := make([]firewall.Entry, 0, len(cmd.IPs))
+	for _, ip := range cmd.IPs {
+		entries = append(entries, firewall.Entry{IP: ip, Timeout: cmd.Timeout})
+	}
+	return p.apply(ctx, cmd.BlockID, entries)
+}
+
+// ApplySnapshot применяет снимок активных блокировок с оставшимся сроком действия каждой.
+func (p *MessageProcessor) ApplySnapshot(ctx context.Context, body []byte) (*models.BlockResult, error) {
+	var snapshot models.BlockSnapshot
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать снимок блокировок: %w", err)
+	}
+
+	now := time.Now()
+	entries := make([]firewall.Entry, 0, len(snapshot.Blocks))
+	for _, block := range snapshot.Blocks {
+		ip, err := canonicalIP(block.IP)
+		if err != nil {
+			p.logger.Warning(fmt.Sprintf("Пропускаем некорректный адрес '%s' в снимке блокировок: %v", block.IP, err))
+			continue
+		}
+		remaining := block.ExpiresAt.Sub(now).Truncate(time.Second)
+		if remaining <= 0 {
+			continue
+		}
+		if remaining > p.cfg.MaxBlockDuration {
+			remaining = p.cfg.MaxBlockDuration
+		}
+		entries = append(entries, firewall.Entry{IP: ip, Timeout: remaining})
+	}
+
+	p.logger.Info(fmt.Sprintf("Получен снимок блокировок: %d активных IP, применяем...", len(entries)))
+	return p.apply(ctx, "", entries), nil
+}
+
+// apply добавляет IP-адреса в blacklist и собирает результат по каждому из них.
+// Адреса из локального allowlist не передаются бэкенду и попадают в RefusedIPs.
+func (p *MessageProcessor) apply(ctx context.Context, blockID string, entries []firewall.Entry) *models.BlockResult {
+	allowed, refused := p.filterAllowlisted(blockID, entries)
+
+	var results []firewall.Result
+	if len(allowed) > 0 {
+		start := time.Now()
+		results = p.backend.Block(ctx, allowed)
+		p.metrics.FirewallLatency.Observe(time.Since(start))
 	}
 
-	duration := payload.Duration
-	if duration == "" {
-		duration = "5m"
+	result := p.collect(blockID, results)
+	result.RefusedIPs = refused
+	return result
+}
+
+// filterAllowlisted отделяет адреса, защищенные локальным allowlist, от остальных.
+func (p *MessageProcessor) filterAllowlisted(blockID string, entries []firewall.Entry) ([]firewall.Entry, []string) {
+	allowed := make([]firewall.Entry, 0, len(entries))
+	var refused []string
+	for _, entry := range entries {
+		if p.allowlist.Contains(entry.IP) {
+			refused = append(refused, entry.IP)
+			continue
+		}
+		allowed = append(allowed, entry)
+	}
+
+	if len(refused) > 0 {
+		p.metrics.IPsRefused.Add(len(refused))
+		p.logger.Warning(fmt.Sprintf("Блокировка %s: отказано в блокировке %d IP из локального allowlist: %s",
+			blockID, len(refused), strings.Join(refused, ", ")))
 	}
+	return allowed, refused
+}
 
-	if !validDurationPattern.MatchString(duration) {
-		err := fmt.Errorf("недопустимый формат duration, сообщение отклонено: '%s'", duration)
-		p.logger.Error(err.Error())
-		return err
+// collect формирует отчет о применении команды по результатам бэкенда.
+func (p *MessageProcessor) collect(blockID string, results []firewall.Result) *models.BlockResult {
+	result := &models.BlockResult{
+		BlockID:    blockID,
+		AppliedIPs: []string{},
+		FailedIPs:  []string{},
 	}
 
-	var wg sync.WaitGroup
-	for _, ip := range payload.IPs {
-		wg.Add(1)
-		go func(ipAddress string) {
-			defer wg.Done()
-			err := p.executor.RunNftCommand(ctx, "add", "element", "inet", "firewall", "user_blacklist", "{", ipAddress, "timeout", duration, "}")
-			if err != nil {
-				p.logger.Error(fmt.Sprintf("Ошибка при обработке IP %s: %v", ipAddress, err))
-			}
-		}(ip)
+	var errMsg []string
+	for _, res := range results {
+		if res.Err != nil {
+			p.logger.Error(fmt.Sprintf("Ошибка при обработке IP %s: %v", res.IP, res.Err))
+			result.FailedIPs = append(result.FailedIPs, res.IP)
+			errMsg = append(errMsg, fmt.Sprintf("%s: %v", res.IP, res.Err))
+			continue
+		}
+		result.AppliedIPs = append(result.AppliedIPs, res.IP)
 	}
-	wg.Wait()
-	return nil
-}
\ No newline at end of file
+
+	p.metrics.IPsApplied.Add(len(result.AppliedIPs))
+	p.metrics.IPsFailed.Add(len(result.FailedIPs))
+
+	result.Error = strings.Join(errMsg, "; ")
+	result.ProcessedAt = time.Now()
+	return result
+}
+
+// parseDuration разбирает длительность в формате nftables (например, 5m или 1d).
+func parseDuration(value string) (time.Duration, error) {
+	matches := validDurationPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("недопустимый формат duration '%s'", value)
+	}
+	amount, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("недопустимое значение duration '%s': %w", value, err)
+	}
+
+	unit := time.Second
+	switch matches[2] {
+	case "m":
+		unit = time.Minute
+	case "h":
+		unit = time.Hour
+	case "d":
+		unit = 24 * time.Hour
+	}
+	if int64(amount) > math.MaxInt64/int64(unit) {
+		return 0, fmt.Errorf("слишком большое значение duration '%s'", value)
+	}
+	return time.Duration(amount) * unit, nil
+}
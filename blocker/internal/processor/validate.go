@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"blocker-worker/internal/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ValidationError описывает одно нарушение в команде блокировки.
+type ValidationError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("%s '%s': %s", e.Field, e.Value, e.Reason)
+}
+
+// ValidationErrors — все нарушения, найденные в команде. Сравнивается с ErrInvalidPayload через errors.Is.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, v := range e {
+		parts = append(parts, v.Error())
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidPayload, strings.Join(parts, "; "))
+}
+
+// Is позволяет проверять ошибку проверки через errors.Is(err, ErrInvalidPayload).
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidPayload
+}
+
+// command — проверенная команда: адреса канонизированы и без повторов, срок разобран.
+type command struct {
+	BlockID string
+	IPs     []string
+	Timeout time.Duration
+}
+
+// decodePayload строго разбирает тело сообщения: неизвестные поля и лишние данные после JSON запрещены.
+func decodePayload(body []byte) (models.BlockingPayload, error) {
+	var payload models.BlockingPayload
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&payload); err != nil {
+		return payload, ValidationErrors{{Field: "body", Reason: err.Error()}}
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return payload, ValidationErrors{{Field: "body", Reason: "лишние данные после JSON-объекта"}}
+	}
+	return payload, nil
+}
+
+// validate проверяет команду и приводит ее к виду, безопасному для передачи бэкенду файрвола.
+func (p *MessageProcessor) validate(payload models.BlockingPayload) (*command, error) {
+	var errs ValidationErrors
+	cmd := &command{BlockID: payload.BlockID}
+
+	if len(payload.IPs) > p.cfg.MaxIPsPerMessage {
+		errs = append(errs, ValidationError{
+			Field:  "ips",
+			Reason: fmt.Sprintf("%d адресов превышает лимит %d на сообщение", len(payload.IPs), p.cfg.MaxIPsPerMessage),
+		})
+	} else {
+		seen := make(map[string]bool, len(payload.IPs))
+		for i, raw := range payload.IPs {
+			ip, err := canonicalIP(raw)
+			if err != nil {
+				errs = append(errs, ValidationError{Field: fmt.Sprintf("ips[%d]", i), Value: raw, Reason: err.Error()})
+				continue
+			}
+			if !seen[ip] {
+				seen[ip] = true
+				cmd.IPs = append(cmd.IPs, ip)
+			}
+		}
+	}
+
+	duration := payload.Duration
+	if duration == "" {
+		duration = defaultDuration
+	}
+	timeout, err := parseDuration(duration)
+	switch {
+	case err != nil:
+		errs = append(errs, ValidationError{Field: "duration", Value: payload.Duration, Reason: err.Error()})
+	case timeout <= 0:
+		errs = append(errs, ValidationError{Field: "duration", Value: payload.Duration, Reason: "срок блокировки должен быть положительным"})
+	case timeout > p.cfg.MaxBlockDuration:
+		errs = append(errs, ValidationError{
+			Field:  "duration",
+			Value:  payload.Duration,
+			Reason: fmt.Sprintf("превышает максимальный срок блокировки %v", p.cfg.MaxBlockDuration),
+		})
+	default:
+		cmd.Timeout = timeout
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cmd, nil
+}
+
+// canonicalIP разбирает одиночный адрес или префикс хоста (/32, /128) и возвращает его каноническую запись.
+// Set'ы blacklist хранят отдельные адреса, поэтому подсети шире одного хоста не принимаются.
+func canonicalIP(value string) (string, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return "", fmt.Errorf("некорректный префикс")
+		}
+		if !prefix.IsSingleIP() {
+			return "", fmt.Errorf("разрешены только отдельные адреса (/32 или /128)")
+		}
+		return canonicalAddr(prefix.Addr())
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", fmt.Errorf("некорректный IP-адрес")
+	}
+	return canonicalAddr(addr)
+}
+
+func canonicalAddr(addr netip.Addr) (string, error) {
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("адреса с зоной не допускаются")
+	}
+	return addr.Unmap().String(), nil
+}
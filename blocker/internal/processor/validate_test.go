@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"blocker-worker/internal/config"
+	"blocker-worker/internal/models"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	testMaxIPs         = 3
+	testMaxBlockLength = 24 * time.Hour
+)
+
+func newTestProcessor() *MessageProcessor {
+	return &MessageProcessor{cfg: &config.Config{
+		MaxIPsPerMessage: testMaxIPs,
+		MaxBlockDuration: testMaxBlockLength,
+	}}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    models.BlockingPayload
+		wantErr bool
+	}{
+		{
+			name: "корректная команда",
+			body: `{"block_id":"b1","ips":["203.0.113.7"],"duration":"5m"}`,
+			want: models.BlockingPayload{BlockID: "b1", IPs: []string{"203.0.113.7"}, Duration: "5m"},
+		},
+		{
+			name: "пробелы после объекта",
+			body: "{\"ips\":[\"203.0.113.7\"]}\n  \n",
+			want: models.BlockingPayload{IPs: []string{"203.0.113.7"}},
+		},
+		{name: "неизвестное поле", body: `{"ips":["203.0.113.7"],"subnet":"0.0.0.0/0"}`, wantErr: true},
+		{name: "второй объект после первого", body: `{"ips":["203.0.113.7"]}{"ips":["198.51.100.1"]}`, wantErr: true},
+		{name: "мусор после объекта", body: `{"ips":["203.0.113.7"]} x`, wantErr: true},
+		{name: "обрезанный JSON", body: `{"ips":["203.0.113.7"]`, wantErr: true},
+		{name: "неверный тип поля", body: `{"ips":"203.0.113.7"}`, wantErr: true},
+		{name: "пустое тело", body: ``, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePayload([]byte(tt.body))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPayload) {
+					t.Fatalf("decodePayload = %v, ожидалась ошибка %v", err, ErrInvalidPayload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePayload: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodePayload = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "203.0.113.7", want: "203.0.113.7"},
+		{value: "203.0.113.7/32", want: "203.0.113.7"},
+		{value: "2001:DB8:0:0::1", want: "2001:db8::1"},
+		{value: "2001:db8::1/128", want: "2001:db8::1"},
+		{value: "::ffff:203.0.113.7", want: "203.0.113.7"},
+		{value: "::ffff:203.0.113.7/128", want: "203.0.113.7"},
+		{value: "203.0.113.0/24", wantErr: true},
+		{value: "0.0.0.0/0", wantErr: true},
+		{value: "2001:db8::/64", wantErr: true},
+		{value: "203.0.113.7/33", wantErr: true},
+		{value: "fe80::1%eth0", wantErr: true},
+		{value: "fe80::1%eth0/128", wantErr: true},
+		{value: "203.0.113.256", wantErr: true},
+		{value: "example.com", wantErr: true},
+		{value: "203.0.113.7 ", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := canonicalIP(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("canonicalIP(%q) = %q, ожидалась ошибка", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("canonicalIP(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Fatalf("canonicalIP(%q) = %q, ожидалось %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ips := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("203.0.113.%d", i+1)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		payload     models.BlockingPayload
+		wantIPs     []string
+		wantTimeout time.Duration
+		wantFields  []string
+	}{
+		{
+			name:        "срок по умолчанию",
+			payload:     models.BlockingPayload{IPs: []string{"203.0.113.7"}},
+			wantIPs:     []string{"203.0.113.7"},
+			wantTimeout: 5 * time.Minute,
+		},
+		{
+			name:        "повторы после канонизации",
+			payload:     models.BlockingPayload{IPs: []string{"203.0.113.7", "::ffff:203.0.113.7", "203.0.113.7/32"}, Duration: "1h"},
+			wantIPs:     []string{"203.0.113.7"},
+			wantTimeout: time.Hour,
+		},
+		{
+			name:        "ровно MaxIPsPerMessage адресов",
+			payload:     models.BlockingPayload{IPs: ips(testMaxIPs), Duration: "5m"},
+			wantIPs:     ips(testMaxIPs),
+			wantTimeout: 5 * time.Minute,
+		},
+		{
+			name:       "больше MaxIPsPerMessage адресов",
+			payload:    models.BlockingPayload{IPs: ips(testMaxIPs + 1), Duration: "5m"},
+			wantFields: []string{"ips"},
+		},
+		{
+			name:        "ровно MaxBlockDuration",
+			payload:     models.BlockingPayload{IPs: []string{"203.0.113.7"}, Duration: "24h"},
+			wantIPs:     []string{"203.0.113.7"},
+			wantTimeout: testMaxBlockLength,
+		},
+		{
+			name:        "MaxBlockDuration в днях",
+			payload:     models.BlockingPayload{IPs: []string{"203.0.113.7"}, Duration: "1d"},
+			wantIPs:     []string{"203.0.113.7"},
+			wantTimeout: testMaxBlockLength,
+		},
+		{
+			name:       "больше MaxBlockDuration",
+			payload:    models.BlockingPayload{IPs: []string{"203.0.113.7"}, Duration: "1441m"},
+			wantFields: []string{"duration"},
+		},
+		{
+			name:       "нулевой срок",
+			payload:    models.BlockingPayload{IPs: []string{"203.0.113.7"}, Duration: "0s"},
+			wantFields: []string{"duration"},
+		},
+		{
+			name:       "некорректный срок",
+			payload:    models.BlockingPayload{IPs: []string{"203.0.113.7"}, Duration: "5 minutes"},
+			wantFields: []string{"duration"},
+		},
+		{
+			name:       "все нарушения сразу",
+			payload:    models.BlockingPayload{IPs: []string{"203.0.113.7", "203.0.113.0/24", "fe80::1%eth0"}, Duration: "-5m"},
+			wantFields: []string{"ips[1]", "ips[2]", "duration"},
+		},
+	}
+
+	p := newTestProcessor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := p.validate(tt.payload)
+			if tt.wantFields != nil {
+				var errs ValidationErrors
+				if !errors.As(err, &errs) || !errors.Is(err, ErrInvalidPayload) {
+					t.Fatalf("validate = %v, ожидалась ошибка проверки", err)
+				}
+				fields := make([]string, len(errs))
+				for i, e := range errs {
+					fields[i] = e.Field
+				}
+				if !reflect.DeepEqual(fields, tt.wantFields) {
+					t.Fatalf("нарушения в полях %q, ожидалось %q", fields, tt.wantFields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if !reflect.DeepEqual(cmd.IPs, tt.wantIPs) {
+				t.Fatalf("адреса %q, ожидалось %q", cmd.IPs, tt.wantIPs)
+			}
+			if cmd.Timeout != tt.wantTimeout {
+				t.Fatalf("срок %v, ожидалось %v", cmd.Timeout, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"blocker-worker/internal/logger"
+	"bytes"
 	"context"
 	"fmt"
 	"os/exec"
@@ -20,18 +21,37 @@ func NewExecutor(l *logger.Logger) *Executor {
 
 // RunNftCommand безопасно выполняет команду nftables.
 func (e *Executor) RunNftCommand(ctx context.Context, args ...string) error {
-	// Добавляем 'nft' в начало списка аргументов
-	fullArgs := append([]string{"nft"}, args...)
+	_, err := e.Run(ctx, "nft", args...)
+	return err
+}
 
-	cmd := exec.CommandContext(ctx, fullArgs[0], fullArgs[1:]...)
+// Run выполняет внешнюю команду без оболочки и возвращает ее объединенный вывод.
+// В случае ошибки вывод команды включается в текст ошибки.
+func (e *Executor) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	output, err := cmd.CombinedOutput()
 
-	fullCommandStr := strings.Join(fullArgs, " ")
+	fullCommandStr := strings.Join(append([]string{name}, args...), " ")
 	if err != nil {
 		e.logger.Error(fmt.Sprintf("Ошибка выполнения команды '%s': %s", fullCommandStr, string(output)))
-		return err
+		return output, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
 	}
 
 	e.logger.Info(fmt.Sprintf("Команда '%s' выполнена успешно.", fullCommandStr))
-	return nil
-}
\ No newline at end of file
+	return output, nil
+}
+
+// Output выполняет команду только для чтения и возвращает ее stdout без записи в лог при успехе.
+func (e *Executor) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		fullCommandStr := strings.Join(append([]string{name}, args...), " ")
+		e.logger.Error(fmt.Sprintf("Ошибка выполнения команды '%s': %s", fullCommandStr, stderr.String()))
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,195 @@
+package firewall
+
+import (
+	"blocker-worker/internal/services/command"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ExecBackend управляет blacklist в nftables, запуская утилиту nft для каждого IP.
+// Не требует доступа к netlink из процесса, но не обеспечивает атомарности.
+type ExecBackend struct {
+	executor *command.Executor
+	target   NftTarget
+}
+
+// NewExecBackend создает бэкенд на основе утилиты nft.
+func NewExecBackend(exec *command.Executor, target NftTarget) (*ExecBackend, error) {
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+	return &ExecBackend{executor: exec, target: target}, nil
+}
+
+// Name возвращает название бэкенда.
+func (b *ExecBackend) Name() string {
+	return BackendExec
+}
+
+// Block запускает отдельную команду nft для каждого IP параллельно.
+func (b *ExecBackend) Block(ctx context.Context, entries []Entry) []Result {
+	return runParallel(len(entries), func(i int) Result {
+		entry := entries[i]
+		set, err := b.target.setFor(entry.IP)
+		if err != nil {
+			return Result{IP: entry.IP, Err: err}
+		}
+		err = b.executor.RunNftCommand(ctx, "add", "element", b.target.Family, b.target.Table, set, "{", entry.IP, "timeout", formatTimeout(entry.Timeout), "}")
+		return Result{IP: entry.IP, Err: err}
+	})
+}
+
+// Unblock удаляет каждый IP отдельной командой nft.
+func (b *ExecBackend) Unblock(ctx context.Context, ips []string) []Result {
+	return runParallel(len(ips), func(i int) Result {
+		set, err := b.target.setFor(ips[i])
+		if err != nil {
+			return Result{IP: ips[i], Err: err}
+		}
+		err = b.executor.RunNftCommand(ctx, "delete", "element", b.target.Family, b.target.Table, set, "{", ips[i], "}")
+		return Result{IP: ips[i], Err: err}
+	})
+}
+
+// nftSetInfo описывает нужную часть вывода `nft -j list set`.
+type nftSetInfo struct {
+	Type  json.RawMessage   `json:"type"`
+	Flags []string          `json:"flags"`
+	Elem  []json.RawMessage `json:"elem"`
+}
+
+type nftListOutput struct {
+	Nftables []struct {
+		Set *nftSetInfo `json:"set"`
+	} `json:"nftables"`
+}
+
+// List читает содержимое set'ов в JSON-формате nft.
+func (b *ExecBackend) List(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	for _, set := range b.target.sets() {
+		info, err := b.describeSet(ctx, set.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range info.Elem {
+			entry, err := parseNftElem(raw)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Flush очищает все настроенные set'ы.
+func (b *ExecBackend) Flush(ctx context.Context) error {
+	for _, set := range b.target.sets() {
+		if err := b.executor.RunNftCommand(ctx, "flush", "set", b.target.Family, b.target.Table, set.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check проверяет тип и флаг timeout каждого настроенного set'а.
+func (b *ExecBackend) Check(ctx context.Context) error {
+	for _, set := range b.target.sets() {
+		info, err := b.describeSet(ctx, set.name)
+		if err != nil {
+			return fmt.Errorf("set %s %s %s недоступен: %w", b.target.Family, b.target.Table, set.name, err)
+		}
+
+		var keyType string
+		if err := json.Unmarshal(info.Type, &keyType); err != nil || keyType != set.keyType {
+			return fmt.Errorf("set %s имеет тип %s, ожидается %s", set.name, string(info.Type), set.keyType)
+		}
+		if !hasFlag(info.Flags, "timeout") {
+			return fmt.Errorf("set %s создан без флага timeout", set.name)
+		}
+	}
+	return nil
+}
+
+// Provision создает таблицу и недостающие set'ы. Команды add идемпотентны.
+func (b *ExecBackend) Provision(ctx context.Context) error {
+	if err := b.executor.RunNftCommand(ctx, "add", "table", b.target.Family, b.target.Table); err != nil {
+		return fmt.Errorf("не удалось создать таблицу %s %s: %w", b.target.Family, b.target.Table, err)
+	}
+	for _, set := range b.target.sets() {
+		spec := fmt.Sprintf("type %s; flags timeout;", set.keyType)
+		if err := b.executor.RunNftCommand(ctx, "add", "set", b.target.Family, b.target.Table, set.name, "{", spec, "}"); err != nil {
+			return fmt.Errorf("не удалось создать set %s: %w", set.name, err)
+		}
+	}
+	return nil
+}
+
+// describeSet возвращает описание set'а из вывода `nft -j list set`.
+func (b *ExecBackend) describeSet(ctx context.Context, name string) (*nftSetInfo, error) {
+	output, err := b.executor.Output(ctx, "nft", "-j", "list", "set", b.target.Family, b.target.Table, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed nftListOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать вывод nft: %w", err)
+	}
+	for _, item := range parsed.Nftables {
+		if item.Set != nil {
+			return item.Set, nil
+		}
+	}
+	return nil, fmt.Errorf("вывод nft не содержит описания set %s", name)
+}
+
+// parseNftElem разбирает элемент set'а: либо строку с адресом,
+// либо объект {"elem": {"val": ..., "expires": ...}} для элементов с таймаутом.
+func parseNftElem(raw json.RawMessage) (Entry, error) {
+	var ip string
+	if err := json.Unmarshal(raw, &ip); err == nil {
+		return Entry{IP: ip}, nil
+	}
+
+	var wrapped struct {
+		Elem struct {
+			Val     string `json:"val"`
+			Expires int64  `json:"expires"`
+		} `json:"elem"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return Entry{}, fmt.Errorf("неизвестный формат элемента nft: %s", string(raw))
+	}
+	return Entry{IP: wrapped.Elem.Val, Timeout: time.Duration(wrapped.Elem.Expires) * time.Second}, nil
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// runParallel выполняет fn для каждого индекса параллельно и собирает результаты по порядку.
+func runParallel(n int, fn func(i int) Result) []Result {
+	results := make([]Result, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
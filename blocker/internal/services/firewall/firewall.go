@@ -0,0 +1,140 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// validNamePattern ограничивает имена таблиц и set'ов, чтобы их нельзя было
+// использовать для подстановки произвольных аргументов в команды.
+var validNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// Названия поддерживаемых бэкендов файрвола.
+const (
+	BackendExec    = "exec"    // nftables через утилиту nft
+	BackendNetlink = "netlink" // nftables через netlink
+	BackendIPSet   = "ipset"   // ipset для хостов с iptables
+)
+
+// Entry описывает IP-адрес, который нужно заблокировать на Timeout.
+// В результатах List поле Timeout содержит оставшееся время блокировки.
+type Entry struct {
+	IP      string
+	Timeout time.Duration
+}
+
+// Result содержит результат применения блокировки для одного IP-адреса.
+type Result struct {
+	IP  string
+	Err error
+}
+
+// Backend применяет блокировки к файрволу ноды.
+type Backend interface {
+	// Block добавляет IP-адреса в blacklist и возвращает результат по каждому из них.
+	Block(ctx context.Context, entries []Entry) []Result
+	// Unblock удаляет IP-адреса из blacklist и возвращает результат по каждому из них.
+	Unblock(ctx context.Context, ips []string) []Result
+	// List возвращает текущее содержимое blacklist.
+	List(ctx context.Context) ([]Entry, error)
+	// Flush удаляет все элементы из blacklist.
+	Flush(ctx context.Context) error
+	// Check проверяет, что set'ы blacklist существуют, имеют нужный тип и поддерживают таймауты.
+	Check(ctx context.Context) error
+	// Provision создает недостающие таблицу и set'ы.
+	Provision(ctx context.Context) error
+	// Name возвращает название бэкенда для логов.
+	Name() string
+}
+
+// NftTarget описывает, куда в nftables добавляются заблокированные адреса.
+// Пустое SetV6 отключает блокировку IPv6-адресов; для таблиц семейства ip и ip6
+// используется только set соответствующего семейства.
+type NftTarget struct {
+	Family string
+	Table  string
+	SetV4  string
+	SetV6  string
+}
+
+// Validate проверяет семейство и имена таблицы и set'ов.
+func (t NftTarget) Validate() error {
+	switch t.Family {
+	case "inet", "ip", "ip6":
+	default:
+		return fmt.Errorf("неподдерживаемое семейство таблицы nftables '%s' (допустимо: inet, ip, ip6)", t.Family)
+	}
+	for _, name := range []string{t.Table, t.SetV4, t.SetV6} {
+		if name != "" && !validNamePattern.MatchString(name) {
+			return fmt.Errorf("недопустимое имя таблицы или set'а nftables '%s'", name)
+		}
+	}
+	if t.Table == "" || len(t.sets()) == 0 {
+		return fmt.Errorf("не задана таблица или ни один set nftables, подходящий для семейства %s", t.Family)
+	}
+	return nil
+}
+
+// nftSet описывает set nftables и тип его ключа.
+type nftSet struct {
+	name    string
+	keyType string
+}
+
+// setV4 возвращает IPv4 set, если он настроен и допустим для семейства таблицы.
+func (t NftTarget) setV4() string {
+	if t.Family == "ip6" {
+		return ""
+	}
+	return t.SetV4
+}
+
+// setV6 возвращает IPv6 set, если он настроен и допустим для семейства таблицы.
+func (t NftTarget) setV6() string {
+	if t.Family == "ip" {
+		return ""
+	}
+	return t.SetV6
+}
+
+// sets возвращает используемые set'ы вместе с их типом в nftables.
+func (t NftTarget) sets() []nftSet {
+	var sets []nftSet
+	if name := t.setV4(); name != "" {
+		sets = append(sets, nftSet{name: name, keyType: "ipv4_addr"})
+	}
+	if name := t.setV6(); name != "" {
+		sets = append(sets, nftSet{name: name, keyType: "ipv6_addr"})
+	}
+	return sets
+}
+
+// setFor выбирает set по семейству адреса.
+func (t NftTarget) setFor(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("некорректный IP-адрес '%s'", ip)
+	}
+	if parsed.To4() != nil {
+		if t.setV4() == "" {
+			return "", fmt.Errorf("set для IPv4 не настроен, адрес %s не может быть заблокирован", ip)
+		}
+		return t.setV4(), nil
+	}
+	if t.setV6() == "" {
+		return "", fmt.Errorf("set для IPv6 не настроен, адрес %s не может быть заблокирован", ip)
+	}
+	return t.setV6(), nil
+}
+
+// formatTimeout переводит длительность в формат таймаута nftables (в секундах).
+func formatTimeout(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
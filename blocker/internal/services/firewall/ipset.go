@@ -0,0 +1,193 @@
+package firewall
+
+import (
+	"blocker-worker/internal/services/command"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPSetBackend управляет blacklist через ipset для хостов, где трафик фильтрует iptables.
+// Set'ы должны быть созданы с поддержкой таймаутов, например:
+//
+//	ipset create user_blacklist hash:ip timeout 0
+//	iptables -I INPUT -m set --match-set user_blacklist src -j DROP
+type IPSetBackend struct {
+	executor *command.Executor
+	setV4    string
+	setV6    string
+}
+
+// NewIPSetBackend создает бэкенд на основе утилиты ipset.
+// Пустое имя setV6 отключает блокировку IPv6-адресов.
+func NewIPSetBackend(exec *command.Executor, setV4, setV6 string) (*IPSetBackend, error) {
+	for _, name := range []string{setV4, setV6} {
+		if name != "" && !validNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("недопустимое имя set'а ipset '%s'", name)
+		}
+	}
+	if setV4 == "" {
+		return nil, fmt.Errorf("не задано имя set'а ipset для IPv4")
+	}
+
+	return &IPSetBackend{
+		executor: exec,
+		setV4:    setV4,
+		setV6:    setV6,
+	}, nil
+}
+
+// Name возвращает название бэкенда.
+func (b *IPSetBackend) Name() string {
+	return BackendIPSet
+}
+
+// Block добавляет каждый IP в set соответствующего семейства. Флаг -exist обновляет
+// таймаут уже заблокированного адреса вместо ошибки.
+func (b *IPSetBackend) Block(ctx context.Context, entries []Entry) []Result {
+	return runParallel(len(entries), func(i int) Result {
+		entry := entries[i]
+		set, err := b.setFor(entry.IP)
+		if err != nil {
+			return Result{IP: entry.IP, Err: err}
+		}
+		seconds := strconv.FormatInt(int64(entry.Timeout/time.Second), 10)
+		_, err = b.executor.Run(ctx, "ipset", "add", set, entry.IP, "timeout", seconds, "-exist")
+		return Result{IP: entry.IP, Err: err}
+	})
+}
+
+// Unblock удаляет каждый IP из set'а соответствующего семейства.
+func (b *IPSetBackend) Unblock(ctx context.Context, ips []string) []Result {
+	return runParallel(len(ips), func(i int) Result {
+		set, err := b.setFor(ips[i])
+		if err != nil {
+			return Result{IP: ips[i], Err: err}
+		}
+		_, err = b.executor.Run(ctx, "ipset", "del", set, ips[i], "-exist")
+		return Result{IP: ips[i], Err: err}
+	})
+}
+
+// List читает содержимое set'ов в формате `ipset save`.
+func (b *IPSetBackend) List(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	for _, set := range b.sets() {
+		output, err := b.executor.Output(ctx, "ipset", "save", set)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parseIPSetSave(output)...)
+	}
+	return entries, nil
+}
+
+// Flush очищает все настроенные set'ы.
+func (b *IPSetBackend) Flush(ctx context.Context) error {
+	for _, set := range b.sets() {
+		if _, err := b.executor.Run(ctx, "ipset", "flush", set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check проверяет, что set'ы существуют, имеют тип hash:ip или hash:net,
+// нужное семейство и поддержку таймаутов.
+func (b *IPSetBackend) Check(ctx context.Context) error {
+	for _, set := range b.sets() {
+		output, err := b.executor.Output(ctx, "ipset", "-t", "list", set)
+		if err != nil {
+			return fmt.Errorf("set ipset %s недоступен: %w", set, err)
+		}
+
+		var setType, header string
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if v, ok := strings.CutPrefix(line, "Type:"); ok {
+				setType = strings.TrimSpace(v)
+			}
+			if v, ok := strings.CutPrefix(line, "Header:"); ok {
+				header = " " + strings.TrimSpace(v) + " "
+			}
+		}
+
+		if setType != "hash:ip" && setType != "hash:net" {
+			return fmt.Errorf("set ipset %s имеет тип %s, ожидается hash:ip или hash:net", set, setType)
+		}
+		if !strings.Contains(header, " family "+b.familyOf(set)+" ") {
+			return fmt.Errorf("set ipset %s создан для другого семейства адресов, ожидается %s", set, b.familyOf(set))
+		}
+		if !strings.Contains(header, " timeout ") {
+			return fmt.Errorf("set ipset %s создан без поддержки timeout", set)
+		}
+	}
+	return nil
+}
+
+// Provision создает недостающие set'ы с поддержкой таймаутов.
+func (b *IPSetBackend) Provision(ctx context.Context) error {
+	for _, set := range b.sets() {
+		if _, err := b.executor.Run(ctx, "ipset", "create", set, "hash:ip", "family", b.familyOf(set), "timeout", "0", "-exist"); err != nil {
+			return fmt.Errorf("не удалось создать set ipset %s: %w", set, err)
+		}
+	}
+	return nil
+}
+
+func (b *IPSetBackend) familyOf(set string) string {
+	if set == b.setV6 {
+		return "inet6"
+	}
+	return "inet"
+}
+
+func (b *IPSetBackend) sets() []string {
+	if b.setV6 == "" {
+		return []string{b.setV4}
+	}
+	return []string{b.setV4, b.setV6}
+}
+
+// setFor выбирает set по семейству адреса.
+func (b *IPSetBackend) setFor(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("некорректный IP-адрес '%s'", ip)
+	}
+	if parsed.To4() != nil {
+		return b.setV4, nil
+	}
+	if b.setV6 == "" {
+		return "", fmt.Errorf("set для IPv6 не настроен, адрес %s не может быть заблокирован", ip)
+	}
+	return b.setV6, nil
+}
+
+// parseIPSetSave разбирает строки вида "add <set> <ip> timeout <seconds>".
+func parseIPSetSave(output []byte) []Entry {
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "add" {
+			continue
+		}
+		entry := Entry{IP: fields[2]}
+		for i := 3; i+1 < len(fields); i++ {
+			if fields[i] == "timeout" {
+				if seconds, err := strconv.Atoi(fields[i+1]); err == nil {
+					entry.Timeout = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,288 @@
+package firewall
+
+import (
+	"blocker-worker/internal/logger"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/google/nftables"
+)
+
+// NetlinkBackend работает с nftables напрямую через netlink, без запуска внешних процессов.
+// Все элементы одного вызова Block добавляются одной транзакцией: либо все, либо ни одного.
+type NetlinkBackend struct {
+	logger *logger.Logger
+	conn   *nftables.Conn
+	table  *nftables.Table
+	target NftTarget
+	mu     sync.Mutex
+}
+
+// NewNetlinkBackend открывает постоянное netlink-соединение с nftables.
+func NewNetlinkBackend(l *logger.Logger, target NftTarget) (*NetlinkBackend, error) {
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := nftables.New(nftables.AsLasting())
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть netlink-соединение с nftables: %w", err)
+	}
+
+	return &NetlinkBackend{
+		logger: l,
+		conn:   conn,
+		table:  &nftables.Table{Name: target.Table, Family: tableFamily(target.Family)},
+		target: target,
+	}, nil
+}
+
+// Name возвращает название бэкенда.
+func (b *NetlinkBackend) Name() string {
+	return BackendNetlink
+}
+
+// Block добавляет все корректные элементы одной транзакцией.
+// Адреса, не подходящие под настроенные set'ы, отклоняются до транзакции;
+// ошибка ядра относится ко всем элементам транзакции.
+func (b *NetlinkBackend) Block(ctx context.Context, entries []Entry) []Result {
+	ips := make([]string, len(entries))
+	for i, entry := range entries {
+		ips[i] = entry.IP
+	}
+
+	return b.transact(ctx, ips, func(i int, key []byte) nftables.SetElement {
+		return nftables.SetElement{Key: key, Timeout: entries[i].Timeout}
+	}, b.conn.SetAddElements)
+}
+
+// Unblock удаляет все корректные элементы одной транзакцией.
+func (b *NetlinkBackend) Unblock(ctx context.Context, ips []string) []Result {
+	return b.transact(ctx, ips, func(_ int, key []byte) nftables.SetElement {
+		return nftables.SetElement{Key: key}
+	}, b.conn.SetDeleteElements)
+}
+
+// transact группирует корректные адреса по set'ам и применяет op ко всем set'ам одной транзакцией.
+func (b *NetlinkBackend) transact(
+	ctx context.Context,
+	ips []string,
+	element func(i int, key []byte) nftables.SetElement,
+	op func(*nftables.Set, []nftables.SetElement) error,
+) []Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	results := make([]Result, len(ips))
+	for i, ip := range ips {
+		results[i].IP = ip
+	}
+
+	if err := ctx.Err(); err != nil {
+		return failAll(results, err)
+	}
+
+	sets := make(map[string]*nftables.Set)
+	elements := make(map[string][]nftables.SetElement)
+	batched := make([]int, 0, len(ips))
+	for i, ip := range ips {
+		name, err := b.target.setFor(ip)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		set, ok := sets[name]
+		if !ok {
+			set, err = b.conn.GetSetByName(b.table, name)
+			if err != nil {
+				results[i].Err = fmt.Errorf("set %s не найден: %w", name, err)
+				continue
+			}
+			sets[name] = set
+		}
+		key, err := elementKey(set, ip)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		elements[name] = append(elements[name], element(i, key))
+		batched = append(batched, i)
+	}
+	if len(batched) == 0 {
+		return results
+	}
+
+	for name, setElements := range elements {
+		if err := op(sets[name], setElements); err != nil {
+			return failBatch(results, batched, fmt.Errorf("ошибка подготовки транзакции: %w", err))
+		}
+	}
+	if err := b.conn.Flush(); err != nil {
+		return failBatch(results, batched, fmt.Errorf("ошибка применения транзакции nftables: %w", err))
+	}
+
+	b.logger.Info(fmt.Sprintf("Транзакция nftables применена: %d элементов.", len(batched)))
+	return results
+}
+
+// List возвращает элементы всех настроенных set'ов с оставшимся временем жизни.
+func (b *NetlinkBackend) List(ctx context.Context) ([]Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, target := range b.target.sets() {
+		set, err := b.conn.GetSetByName(b.table, target.name)
+		if err != nil {
+			return nil, fmt.Errorf("set %s не найден: %w", target.name, err)
+		}
+		elements, err := b.conn.GetSetElements(set)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения элементов set %s: %w", target.name, err)
+		}
+		for _, element := range elements {
+			entries = append(entries, Entry{IP: net.IP(element.Key).String(), Timeout: element.Expires})
+		}
+	}
+	return entries, nil
+}
+
+// Flush удаляет все элементы настроенных set'ов одной транзакцией.
+func (b *NetlinkBackend) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, target := range b.target.sets() {
+		set, err := b.conn.GetSetByName(b.table, target.name)
+		if err != nil {
+			return fmt.Errorf("set %s не найден: %w", target.name, err)
+		}
+		b.conn.FlushSet(set)
+	}
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("ошибка очистки blacklist: %w", err)
+	}
+	return nil
+}
+
+// Check проверяет тип ключа и флаг timeout каждого настроенного set'а.
+func (b *NetlinkBackend) Check(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, target := range b.target.sets() {
+		set, err := b.conn.GetSetByName(b.table, target.name)
+		if err != nil {
+			return fmt.Errorf("set %s %s %s недоступен: %w", b.target.Family, b.target.Table, target.name, err)
+		}
+		if set.KeyType.Name != target.keyType {
+			return fmt.Errorf("set %s имеет тип %s, ожидается %s", target.name, set.KeyType.Name, target.keyType)
+		}
+		if !set.HasTimeout {
+			return fmt.Errorf("set %s создан без флага timeout", target.name)
+		}
+	}
+	return nil
+}
+
+// Provision создает таблицу и недостающие set'ы одной транзакцией.
+func (b *NetlinkBackend) Provision(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	table := b.conn.AddTable(b.table)
+	for _, target := range b.target.sets() {
+		if _, err := b.conn.GetSetByName(b.table, target.name); err == nil {
+			continue
+		}
+		keyType := nftables.TypeIPAddr
+		if target.keyType == nftables.TypeIP6Addr.Name {
+			keyType = nftables.TypeIP6Addr
+		}
+		set := &nftables.Set{
+			Table:      table,
+			Name:       target.name,
+			KeyType:    keyType,
+			HasTimeout: true,
+		}
+		if err := b.conn.AddSet(set, nil); err != nil {
+			return fmt.Errorf("не удалось подготовить создание set %s: %w", target.name, err)
+		}
+	}
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("не удалось создать таблицу и set'ы nftables: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает netlink-соединение.
+func (b *NetlinkBackend) Close() error {
+	return b.conn.CloseLasting()
+}
+
+// tableFamily переводит название семейства в константу nftables.
+func tableFamily(family string) nftables.TableFamily {
+	switch family {
+	case "ip":
+		return nftables.TableFamilyIPv4
+	case "ip6":
+		return nftables.TableFamilyIPv6
+	default:
+		return nftables.TableFamilyINet
+	}
+}
+
+// elementKey кодирует IP-адрес в ключ элемента в соответствии с типом set'а.
+func elementKey(set *nftables.Set, ip string) ([]byte, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("некорректный IP-адрес '%s'", ip)
+	}
+
+	switch set.KeyType {
+	case nftables.TypeIPAddr:
+		if v4 := parsed.To4(); v4 != nil {
+			return v4, nil
+		}
+		return nil, fmt.Errorf("IPv6-адрес %s не подходит для set %s типа ipv4_addr", ip, set.Name)
+	case nftables.TypeIP6Addr:
+		if parsed.To4() != nil {
+			return nil, fmt.Errorf("IPv4-адрес %s не подходит для set %s типа ipv6_addr", ip, set.Name)
+		}
+		return parsed.To16(), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип ключа set %s: %s", set.Name, set.KeyType.Name)
+	}
+}
+
+func failAll(results []Result, err error) []Result {
+	for i := range results {
+		results[i].Err = err
+	}
+	return results
+}
+
+func failBatch(results []Result, batched []int, err error) []Result {
+	for _, i := range batched {
+		results[i].Err = err
+	}
+	return results
+}
@@ -1,36 +1,46 @@
 package rabbitmq
 
 import (
+	"blocker-worker/internal/config"
 	"blocker-worker/internal/logger"
+	"blocker-worker/internal/services/transport"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"time"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 const (
 	blockingExchangeName = "blocking_exchange"
+	directReplyQueue     = "amq.rabbitmq.reply-to"
+
+	// RetryCountHeader хранит число уже выполненных повторных попыток обработки сообщения.
+	RetryCountHeader = "x-retry-count"
 )
 
 // Consumer обрабатывает подключение и получение сообщений из RabbitMQ.
 type Consumer struct {
-	logger      *logger.Logger
-	conn        *amqp.Connection
-	channel     *amqp.Channel
-	rabbitMQURL string
+	logger  *logger.Logger
+	cfg     *config.Config
+	conn    *amqp.Connection
+	channel *amqp.Channel
 }
 
 // NewConsumer создает нового потребителя RabbitMQ.
-func NewConsumer(l *logger.Logger, url string) *Consumer {
+func NewConsumer(l *logger.Logger, cfg *config.Config) *Consumer {
 	return &Consumer{
-		logger:      l,
-		rabbitMQURL: url,
+		logger: l,
+		cfg:    cfg,
 	}
 }
 
 // Connect устанавливает соединение с RabbitMQ и настраивает канал.
 func (c *Consumer) Connect() error {
 	var err error
-	c.conn, err = amqp.Dial(c.rabbitMQURL)
+	c.conn, err = amqp.Dial(c.cfg.RabbitMQURL)
 	if err != nil {
 		return fmt.Errorf("не удалось подключиться к RabbitMQ: %w", err)
 	}
@@ -41,13 +51,21 @@ func (c *Consumer) Connect() error {
 		return fmt.Errorf("не удалось открыть канал: %w", err)
 	}
 
+	// Режим подтверждений публикации нужен Retry: исходное сообщение подтверждается,
+	// только когда брокер принял его копию в retry-очередь.
+	if err := c.channel.Confirm(false); err != nil {
+		c.conn.Close()
+		return fmt.Errorf("не удалось включить подтверждения публикации: %w", err)
+	}
+
 	c.logger.Info("Соединение с RabbitMQ успешно установлено.")
 	return nil
 }
 
-// SetupAndConsume настраивает обменник, очередь и начинает потребление сообщений.
-// Принимает функцию-обработчик для обработки сообщений.
-func (c *Consumer) SetupAndConsume(ctx context.Context, handler func(context.Context, amqp.Delivery) error) error {
+// Setup настраивает обменники, dead-letter и retry-очереди и привязывает к exchange блокировок
+// устойчивую очередь ноды. После Setup новые команды накапливаются в очереди,
+// даже если потребление еще не начато или нода временно отключена.
+func (c *Consumer) Setup() error {
 	if err := c.channel.Qos(1, 0, false); err != nil {
 		return fmt.Errorf("не удалось установить QoS: %w", err)
 	}
@@ -59,22 +77,135 @@ func (c *Consumer) SetupAndConsume(ctx context.Context, handler func(context.Con
 		return fmt.Errorf("не удалось объявить exchange: %w", err)
 	}
 
-	q, err := c.channel.QueueDeclare(
-		"", false, false, true, false, nil,
+	err = c.channel.ExchangeDeclare(
+		c.cfg.ResultsExchangeName, "fanout", true, false, false, false, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось объявить exchange результатов: %w", err)
+	}
+
+	if err := c.setupDeadLetter(); err != nil {
+		return err
+	}
+
+	queueArgs := amqp.Table{
+		"x-dead-letter-exchange": c.cfg.DeadLetterExchange,
+	}
+	if c.cfg.QueueExpires > 0 {
+		queueArgs["x-expires"] = c.cfg.QueueExpires.Milliseconds()
+	}
+	_, err = c.channel.QueueDeclare(
+		c.cfg.QueueName, true, false, false, false, queueArgs,
 	)
 	if err != nil {
 		return fmt.Errorf("не удалось объявить очередь: %w", err)
 	}
 
 	err = c.channel.QueueBind(
-		q.Name, "", blockingExchangeName, false, nil,
+		c.cfg.QueueName, "", blockingExchangeName, false, nil,
 	)
 	if err != nil {
 		return fmt.Errorf("не удалось привязать очередь: %w", err)
 	}
 
+	// Retry-очередь не имеет потребителей: сообщения лежат в ней RetryDelay
+	// и по истечении TTL возвращаются в основную очередь ноды.
+	retryArgs := amqp.Table{
+		"x-message-ttl":             c.cfg.RetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": c.cfg.QueueName,
+	}
+	if c.cfg.QueueExpires > 0 {
+		retryArgs["x-expires"] = c.cfg.QueueExpires.Milliseconds()
+	}
+	_, err = c.channel.QueueDeclare(
+		c.retryQueueName(), true, false, false, false, retryArgs,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось объявить retry-очередь: %w", err)
+	}
+
+	c.logger.Info(fmt.Sprintf("Очередь %s настроена (dead-letter: %s).", c.cfg.QueueName, c.cfg.DeadLetterExchange))
+	return nil
+}
+
+// setupDeadLetter объявляет dead-letter exchange и очередь, в которой
+// отклоненные сообщения остаются доступными для разбора.
+func (c *Consumer) setupDeadLetter() error {
+	err := c.channel.ExchangeDeclare(
+		c.cfg.DeadLetterExchange, "fanout", true, false, false, false, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось объявить dead-letter exchange: %w", err)
+	}
+
+	_, err = c.channel.QueueDeclare(
+		c.cfg.DeadLetterQueue, true, false, false, false, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось объявить dead-letter очередь: %w", err)
+	}
+
+	err = c.channel.QueueBind(
+		c.cfg.DeadLetterQueue, "", c.cfg.DeadLetterExchange, false, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось привязать dead-letter очередь: %w", err)
+	}
+	return nil
+}
+
+func (c *Consumer) retryQueueName() string {
+	return c.cfg.QueueName + ".retry"
+}
+
+// RequestSnapshot запрашивает у observer снимок активных блокировок через direct reply-to.
+// Возвращает ответ observer (тело и заголовки с подписью) или ошибку, если observer не ответил за timeout.
+func (c *Consumer) RequestSnapshot(ctx context.Context) (transport.Reply, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return transport.Reply{}, fmt.Errorf("не удалось открыть канал для запроса снимка: %w", err)
+	}
+	defer ch.Close()
+
+	replies, err := ch.Consume(directReplyQueue, "", true, false, false, false, nil)
+	if err != nil {
+		return transport.Reply{}, fmt.Errorf("не удалось подписаться на ответы: %w", err)
+	}
+
+	correlationID := newCorrelationID()
+	reqCtx, cancel := context.WithTimeout(ctx, c.cfg.SnapshotTimeout)
+	defer cancel()
+
+	err = ch.PublishWithContext(reqCtx, "", c.cfg.SnapshotQueueName, false, false, amqp.Publishing{
+		AppId:         c.cfg.NodeID,
+		CorrelationId: correlationID,
+		ReplyTo:       directReplyQueue,
+	})
+	if err != nil {
+		return transport.Reply{}, fmt.Errorf("не удалось отправить запрос снимка: %w", err)
+	}
+
+	for {
+		select {
+		case <-reqCtx.Done():
+			return transport.Reply{}, fmt.Errorf("observer не ответил на запрос снимка: %w", reqCtx.Err())
+		case reply, ok := <-replies:
+			if !ok {
+				return transport.Reply{}, fmt.Errorf("канал ответов RabbitMQ был закрыт")
+			}
+			if reply.CorrelationId == correlationID {
+				return transport.Reply{Body: reply.Body, Headers: reply.Headers}, nil
+			}
+		}
+	}
+}
+
+// Consume начинает потребление сообщений из очереди, настроенной в Setup.
+// Принимает функцию-обработчик для обработки сообщений.
+func (c *Consumer) Consume(ctx context.Context, handler func(context.Context, transport.Delivery) error) error {
 	msgs, err := c.channel.Consume(
-		q.Name, "", false, false, false, false, nil,
+		c.cfg.QueueName, "", false, false, false, false, nil,
 	)
 	if err != nil {
 		return fmt.Errorf("не удалось зарегистрировать потребителя: %w", err)
@@ -91,13 +222,86 @@ func (c *Consumer) SetupAndConsume(ctx context.Context, handler func(context.Con
 			if !ok {
 				return fmt.Errorf("канал сообщений RabbitMQ был закрыт")
 			}
-			if err := handler(ctx, msg); err != nil {
+			if err := handler(ctx, &delivery{msg: msg, consumer: c}); err != nil {
 				c.logger.Error(fmt.Sprintf("Ошибка при вызове обработчика сообщения: %v", err))
 			}
 		}
 	}
 }
 
+// PublishResult публикует результат обработки команды в exchange результатов.
+func (c *Consumer) PublishResult(ctx context.Context, body []byte) error {
+	err := c.channel.PublishWithContext(
+		ctx,
+		c.cfg.ResultsExchangeName,
+		"",
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         body,
+			DeliveryMode: amqp.Persistent,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось опубликовать результат: %w", err)
+	}
+	return nil
+}
+
+// Retry откладывает повторную обработку сообщения: публикует его копию в retry-очередь
+// с увеличенным счетчиком попыток и ждет подтверждения брокера. Исходное сообщение можно
+// подтверждать, только если Retry вернул nil.
+func (c *Consumer) Retry(ctx context.Context, msg amqp.Delivery, attempt int) error {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[RetryCountHeader] = int32(attempt)
+
+	confirm, err := c.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		c.retryQueueName(),
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      headers,
+			ContentType:  msg.ContentType,
+			MessageId:    msg.MessageId,
+			Timestamp:    msg.Timestamp,
+			Body:         msg.Body,
+			DeliveryMode: amqp.Persistent,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("не удалось отправить сообщение в retry-очередь: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("не получено подтверждение публикации в retry-очередь: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("брокер отклонил сообщение для retry-очереди")
+	}
+	return nil
+}
+
+// RetryCount возвращает число уже выполненных повторных попыток для сообщения.
+func RetryCount(msg amqp.Delivery) int {
+	switch v := msg.Headers[RetryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
 // Close корректно закрывает соединение и канал.
 func (c *Consumer) Close() {
 	if c.channel != nil {
@@ -107,4 +311,12 @@ func (c *Consumer) Close() {
 		c.conn.Close()
 	}
 	c.logger.Info("Соединение с RabbitMQ закрыто.")
-}
\ No newline at end of file
+}
+
+func newCorrelationID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,48 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// delivery адаптирует сообщение RabbitMQ к transport.Delivery.
+type delivery struct {
+	msg      amqp.Delivery
+	consumer *Consumer
+}
+
+func (d *delivery) Body() []byte {
+	return d.msg.Body
+}
+
+func (d *delivery) Headers() map[string]interface{} {
+	return d.msg.Headers
+}
+
+func (d *delivery) RetryCount() int {
+	return RetryCount(d.msg)
+}
+
+func (d *delivery) Ack() error {
+	return d.msg.Ack(false)
+}
+
+// Retry публикует копию сообщения в retry-очередь и подтверждает исходное, только когда
+// брокер подтвердил публикацию. Иначе исходное сообщение возвращается в очередь,
+// чтобы команда не потерялась.
+func (d *delivery) Retry(ctx context.Context, attempt int) error {
+	if err := d.consumer.Retry(ctx, d.msg, attempt); err != nil {
+		if nackErr := d.msg.Nack(false, true); nackErr != nil {
+			return fmt.Errorf("%w; не удалось вернуть сообщение в очередь: %v", err, nackErr)
+		}
+		return err
+	}
+	return d.msg.Ack(false)
+}
+
+// DeadLetter отклоняет сообщение без возврата в очередь; RabbitMQ перенаправляет его в dead-letter exchange.
+func (d *delivery) DeadLetter() error {
+	return d.msg.Nack(false, false)
+}
@@ -0,0 +1,39 @@
+package redisstream
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newClient создает клиент Redis для режима REDIS_MODE (как у observer):
+//   - single: один сервер, redis://[user:password@]host:port/db;
+//   - sentinel: адреса Sentinel, redis://sentinel1:26379/db?master_name=mymaster&addr=sentinel2:26379&password=...;
+//   - cluster: узлы Redis Cluster, redis://node1:6379?addr=node2:6379&addr=node3:6379.
+func newClient(mode, redisURL string) (redis.UniversalClient, error) {
+	switch mode {
+	case "", "single":
+		opt, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка парсинга Redis URL: %w", err)
+		}
+		return redis.NewClient(opt), nil
+	case "sentinel":
+		opt, err := redis.ParseFailoverURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка парсинга Redis URL (sentinel): %w", err)
+		}
+		if opt.MasterName == "" {
+			return nil, fmt.Errorf("в Redis URL для режима sentinel не задан параметр master_name")
+		}
+		return redis.NewFailoverClient(opt), nil
+	case "cluster":
+		opt, err := redis.ParseClusterURL(redisURL)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка парсинга Redis URL (cluster): %w", err)
+		}
+		return redis.NewClusterClient(opt), nil
+	default:
+		return nil, fmt.Errorf("неизвестный режим Redis '%s' (доступны: single, sentinel, cluster)", mode)
+	}
+}
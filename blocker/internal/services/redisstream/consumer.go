@@ -0,0 +1,270 @@
+package redisstream
+
+import (
+	"blocker-worker/internal/config"
+	"blocker-worker/internal/logger"
+	"blocker-worker/internal/models"
+	"blocker-worker/internal/services/transport"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// bodyField — поле записи потока с телом команды; остальные поля передаются как заголовки.
+	bodyField = "body"
+
+	readCount = 10
+	readBlock = 5 * time.Second
+	opTimeout = 5 * time.Second
+)
+
+// Consumer получает команды блокировки из Redis Stream.
+// Каждая нода читает поток своей группой потребителей (имя группы — очередь ноды), поэтому
+// каждая команда доставляется всем нодам, а неподтвержденные записи остаются в pending-списке группы.
+type Consumer struct {
+	logger *logger.Logger
+	cfg    *config.Config
+	client redis.UniversalClient
+}
+
+// NewConsumer создает нового потребителя Redis Streams.
+func NewConsumer(l *logger.Logger, cfg *config.Config) *Consumer {
+	return &Consumer{
+		logger: l,
+		cfg:    cfg,
+	}
+}
+
+// Connect подключается к Redis и проверяет соединение.
+func (c *Consumer) Connect() error {
+	client, err := newClient(c.cfg.RedisMode, c.cfg.RedisURL)
+	if err != nil {
+		return err
+	}
+	c.client = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		c.client.Close()
+		return fmt.Errorf("не удалось подключиться к Redis: %w", err)
+	}
+
+	c.logger.Info("Соединение с Redis успешно установлено.")
+	return nil
+}
+
+// Setup создает поток команд и группу потребителей ноды, если их еще нет.
+// Новая группа читает только команды, пришедшие после ее создания; более ранние
+// блокировки нода получает из снимка.
+func (c *Consumer) Setup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	err := c.client.XGroupCreateMkStream(ctx, c.cfg.CommandStream, c.group(), "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("не удалось создать группу потребителей '%s': %w", c.group(), err)
+	}
+	return nil
+}
+
+func (c *Consumer) group() string {
+	return c.cfg.QueueName
+}
+
+// RequestSnapshot кладет запрос снимка в список запросов и ждет ответа observer в собственном ключе.
+func (c *Consumer) RequestSnapshot(ctx context.Context) (transport.Reply, error) {
+	replyKey := c.cfg.SnapshotRequestsKey + ":reply:" + newCorrelationID()
+	request, err := json.Marshal(models.SnapshotRequest{NodeID: c.cfg.NodeID, ReplyTo: replyKey})
+	if err != nil {
+		return transport.Reply{}, fmt.Errorf("ошибка сериализации запроса снимка: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.cfg.SnapshotTimeout+opTimeout)
+	defer cancel()
+
+	if err := c.client.RPush(reqCtx, c.cfg.SnapshotRequestsKey, request).Err(); err != nil {
+		return transport.Reply{}, fmt.Errorf("не удалось отправить запрос снимка: %w", err)
+	}
+
+	res, err := c.client.BLPop(reqCtx, c.cfg.SnapshotTimeout, replyKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return transport.Reply{}, fmt.Errorf("observer не ответил на запрос снимка за %v", c.cfg.SnapshotTimeout)
+	}
+	if err != nil {
+		return transport.Reply{}, fmt.Errorf("ошибка ожидания снимка: %w", err)
+	}
+
+	var reply models.SnapshotReply
+	if err := json.Unmarshal([]byte(res[1]), &reply); err != nil {
+		return transport.Reply{}, fmt.Errorf("не удалось декодировать ответ со снимком: %w", err)
+	}
+	headers := make(map[string]interface{}, len(reply.Headers))
+	for k, v := range reply.Headers {
+		headers[k] = v
+	}
+	return transport.Reply{Body: []byte(reply.Body), Headers: headers}, nil
+}
+
+// Consume читает новые команды группой ноды и периодически забирает зависшие в pending-списке:
+// записи, не подтвержденные дольше RetryDelay (отложенные повторы или прерванная обработка),
+// доставляются повторно, а исчерпавшие лимит доставок уходят в dead-letter поток.
+func (c *Consumer) Consume(ctx context.Context, handler func(context.Context, transport.Delivery) error) error {
+	c.logger.Info(" [*] Воркер готов. Ожидание сообщений о блокировке из Redis Stream...")
+
+	reclaimInterval := c.cfg.RetryDelay / 2
+	if reclaimInterval < time.Second {
+		reclaimInterval = time.Second
+	}
+	nextReclaim := time.Now()
+
+	for {
+		if ctx.Err() != nil {
+			c.logger.Info("Контекст отменен, прекращаем потребление сообщений.")
+			return nil
+		}
+
+		if time.Now().After(nextReclaim) {
+			if err := c.reclaim(ctx, handler); err != nil {
+				return err
+			}
+			nextReclaim = time.Now().Add(reclaimInterval)
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group(),
+			Consumer: c.cfg.NodeID,
+			Streams:  []string{c.cfg.CommandStream, ">"},
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return fmt.Errorf("ошибка чтения потока команд: %w", err)
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				c.dispatch(ctx, handler, msg, 0)
+			}
+		}
+	}
+}
+
+// reclaim забирает записи, не подтвержденные дольше RetryDelay, и обрабатывает их повторно.
+func (c *Consumer) reclaim(ctx context.Context, handler func(context.Context, transport.Delivery) error) error {
+	start := "0-0"
+	for {
+		msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.cfg.CommandStream,
+			Group:    c.group(),
+			MinIdle:  c.cfg.RetryDelay,
+			Start:    start,
+			Count:    readCount,
+			Consumer: c.cfg.NodeID,
+		}).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ошибка забора зависших команд: %w", err)
+		}
+
+		for _, msg := range msgs {
+			retries, err := c.retryCount(ctx, msg.ID)
+			if err != nil {
+				c.logger.Warning(fmt.Sprintf("Не удалось получить число доставок команды %s: %v", msg.ID, err))
+				continue
+			}
+			d := &delivery{consumer: c, msg: msg, retries: retries}
+			if retries > c.cfg.MaxRetries {
+				c.logger.Error(fmt.Sprintf("Команда %s доставлялась %d раз без подтверждения. Сообщение отправлено в dead-letter поток.", msg.ID, retries+1))
+				if err := d.DeadLetter(); err != nil {
+					c.logger.Error(fmt.Sprintf("Ошибка при отправке сообщения в dead-letter: %v", err))
+				}
+				continue
+			}
+			c.dispatch(ctx, handler, msg, retries)
+		}
+
+		if next == "" || next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// dispatch передает запись обработчику. Записи без тела (удаленные из потока) просто подтверждаются.
+func (c *Consumer) dispatch(ctx context.Context, handler func(context.Context, transport.Delivery) error, msg redis.XMessage, retries int) {
+	d := &delivery{consumer: c, msg: msg, retries: retries}
+	if _, ok := msg.Values[bodyField]; !ok {
+		if err := d.Ack(); err != nil {
+			c.logger.Error(fmt.Sprintf("Ошибка при Ack пустой записи %s: %v", msg.ID, err))
+		}
+		return
+	}
+	if err := handler(ctx, d); err != nil {
+		c.logger.Error(fmt.Sprintf("Ошибка при вызове обработчика сообщения: %v", err))
+	}
+}
+
+// retryCount возвращает число повторных доставок записи (доставок минус первая).
+func (c *Consumer) retryCount(ctx context.Context, id string) (int, error) {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.cfg.CommandStream,
+		Group:  c.group(),
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	return int(pending[0].RetryCount) - 1, nil
+}
+
+// PublishResult добавляет результат обработки команды в поток результатов.
+func (c *Consumer) PublishResult(ctx context.Context, body []byte) error {
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.cfg.ResultsStream,
+		MaxLen: int64(c.cfg.StreamMaxLen),
+		Approx: true,
+		Values: map[string]interface{}{bodyField: body},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("не удалось опубликовать результат: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает соединение с Redis.
+func (c *Consumer) Close() {
+	if c.client != nil {
+		c.client.Close()
+	}
+	c.logger.Info("Соединение с Redis закрыто.")
+}
+
+func newCorrelationID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
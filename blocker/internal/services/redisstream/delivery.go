@@ -0,0 +1,76 @@
+package redisstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// delivery адаптирует запись Redis Stream к transport.Delivery.
+type delivery struct {
+	consumer *Consumer
+	msg      redis.XMessage
+	retries  int
+}
+
+func (d *delivery) Body() []byte {
+	body, _ := d.msg.Values[bodyField].(string)
+	return []byte(body)
+}
+
+// Headers возвращает все поля записи, кроме тела.
+func (d *delivery) Headers() map[string]interface{} {
+	headers := make(map[string]interface{}, len(d.msg.Values))
+	for k, v := range d.msg.Values {
+		if k != bodyField {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+func (d *delivery) RetryCount() int {
+	return d.retries
+}
+
+// Ack подтверждает запись в группе ноды.
+func (d *delivery) Ack() error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	return d.consumer.client.XAck(ctx, d.consumer.cfg.CommandStream, d.consumer.group(), d.msg.ID).Err()
+}
+
+// Retry оставляет запись неподтвержденной: через RetryDelay ее заберет reclaim и доставит повторно.
+func (d *delivery) Retry(ctx context.Context, attempt int) error {
+	return nil
+}
+
+// DeadLetter копирует запись в dead-letter поток и подтверждает ее в одной транзакции.
+func (d *delivery) DeadLetter() error {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	c := d.consumer
+	values := make(map[string]interface{}, len(d.msg.Values)+2)
+	for k, v := range d.msg.Values {
+		values[k] = v
+	}
+	values["node_id"] = c.cfg.NodeID
+	values["source_id"] = d.msg.ID
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: c.cfg.DeadLetterStream,
+			MaxLen: int64(c.cfg.StreamMaxLen),
+			Approx: true,
+			Values: values,
+		})
+		pipe.XAck(ctx, c.cfg.CommandStream, c.group(), d.msg.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось переместить запись %s в dead-letter поток: %w", d.msg.ID, err)
+	}
+	return nil
+}
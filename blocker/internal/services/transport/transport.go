@@ -0,0 +1,49 @@
+package transport
+
+import "context"
+
+// Поддерживаемые транспорты команд блокировки.
+const (
+	RabbitMQ = "rabbitmq"
+	Redis    = "redis"
+)
+
+// Delivery — полученная команда блокировки, независимая от транспорта.
+type Delivery interface {
+	// Body возвращает тело команды.
+	Body() []byte
+	// Headers возвращает заголовки команды (в том числе подпись).
+	Headers() map[string]interface{}
+	// RetryCount возвращает число уже выполненных повторных попыток обработки.
+	RetryCount() int
+	// Ack подтверждает окончательную обработку команды.
+	Ack() error
+	// Retry откладывает повторную обработку команды; attempt — номер следующей попытки.
+	// При ошибке команда остается в очереди транспорта и будет доставлена снова.
+	Retry(ctx context.Context, attempt int) error
+	// DeadLetter убирает команду из обработки в хранилище отклоненных сообщений.
+	DeadLetter() error
+}
+
+// Reply — ответ observer на запрос снимка активных блокировок.
+type Reply struct {
+	Body    []byte
+	Headers map[string]interface{}
+}
+
+// Consumer получает команды блокировки и обменивается с observer снимками и результатами.
+// Экземпляр обслуживает одно соединение; при его потере воркер создает новый.
+type Consumer interface {
+	// Connect устанавливает соединение с брокером.
+	Connect() error
+	// Setup подготавливает очереди или группы потребителей ноды.
+	Setup() error
+	// RequestSnapshot запрашивает у observer снимок активных блокировок.
+	RequestSnapshot(ctx context.Context) (Reply, error)
+	// Consume обрабатывает команды до отмены контекста или потери соединения.
+	Consume(ctx context.Context, handler func(context.Context, Delivery) error) error
+	// PublishResult отправляет observer результат применения команды.
+	PublishResult(ctx context.Context, body []byte) error
+	// Close закрывает соединение.
+	Close()
+}
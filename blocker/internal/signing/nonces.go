@@ -0,0 +1,107 @@
+package signing
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nonceCompactMin — сколько строк должно накопиться в файле, прежде чем он будет переписан
+// без вышедших из окна nonce.
+const nonceCompactMin = 1000
+
+// nonceFile — журнал использованных nonce на диске: по строке "<время подписи> <nonce>".
+// Благодаря ему перезапуск блокировщика не открывает окно для повтора перехваченных команд.
+type nonceFile struct {
+	path  string
+	file  *os.File
+	lines int
+}
+
+// openNonceFile загружает nonce, подписанные не раньше cutoff, и открывает журнал для дозаписи.
+func openNonceFile(path string, cutoff time.Time) (*nonceFile, map[string]time.Time, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, nil, fmt.Errorf("не удалось создать каталог для '%s': %w", path, err)
+	}
+
+	seen := make(map[string]time.Time)
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			ts, nonce, ok := strings.Cut(scanner.Text(), " ")
+			if !ok || nonce == "" {
+				continue
+			}
+			unix, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				continue
+			}
+			if signedAt := time.Unix(unix, 0); !signedAt.Before(cutoff) {
+				seen[nonce] = signedAt
+			}
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения '%s': %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("не удалось открыть '%s': %w", path, err)
+	}
+
+	f := &nonceFile{path: path}
+	if err := f.rewrite(seen); err != nil {
+		return nil, nil, err
+	}
+	return f, seen, nil
+}
+
+// append дописывает nonce в журнал и сбрасывает его на диск до подтверждения сообщения.
+func (f *nonceFile) append(nonce string, signedAt time.Time) error {
+	if _, err := fmt.Fprintf(f.file, "%d %s\n", signedAt.Unix(), nonce); err != nil {
+		return err
+	}
+	f.lines++
+	return f.file.Sync()
+}
+
+// needsCompaction сообщает, что журнал заметно длиннее набора действующих nonce.
+func (f *nonceFile) needsCompaction(live int) bool {
+	return f.lines >= nonceCompactMin && f.lines > 2*live
+}
+
+// rewrite атомарно заменяет журнал набором seen и открывает его для дозаписи.
+func (f *nonceFile) rewrite(seen map[string]time.Time) error {
+	tmp := f.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("не удалось записать '%s': %w", tmp, err)
+	}
+	w := bufio.NewWriter(out)
+	for nonce, signedAt := range seen {
+		fmt.Fprintf(w, "%d %s\n", signedAt.Unix(), nonce)
+	}
+	if err := w.Flush(); err == nil {
+		err = out.Sync()
+	}
+	out.Close()
+	if err != nil {
+		return fmt.Errorf("не удалось записать '%s': %w", tmp, err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("не удалось заменить '%s': %w", f.path, err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть '%s': %w", f.path, err)
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.lines = file, len(seen)
+	return nil
+}
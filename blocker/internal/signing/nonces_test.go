@@ -0,0 +1,91 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readJournal возвращает строки журнала nonce.
+func readJournal(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("чтение журнала: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestOpenNonceFileDropsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	now := time.Now()
+	cutoff := now.Add(-time.Hour)
+	journal := fmt.Sprintf("%d fresh\n%d stale\nмусор\n%d\nне-число nonce\n",
+		now.Unix(), cutoff.Add(-time.Minute).Unix(), now.Unix())
+	if err := os.WriteFile(path, []byte(journal), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, seen, err := openNonceFile(path, cutoff)
+	if err != nil {
+		t.Fatalf("openNonceFile: %v", err)
+	}
+	defer f.file.Close()
+
+	if _, ok := seen["fresh"]; !ok || len(seen) != 1 {
+		t.Fatalf("загружены nonce %v, ожидался только fresh", seen)
+	}
+	if lines := readJournal(t, path); len(lines) != 1 || lines[0] != fmt.Sprintf("%d fresh", now.Unix()) {
+		t.Fatalf("журнал после открытия: %q", lines)
+	}
+}
+
+func TestNonceFileCompaction(t *testing.T) {
+	priv, pub := testKeys(t)
+	path := filepath.Join(t.TempDir(), "nonces")
+	v := newTestVerifier(t, pub, path)
+	body := []byte(`{}`)
+
+	// Подписи старше окна удаляются из памяти при каждом MarkUsed, поэтому действующий набор
+	// остается маленьким, а журнал растет, пока не будет переписан.
+	stale := time.Now().Add(-testMaxAge - clockSkew - time.Minute)
+	for i := 0; i < nonceCompactMin; i++ {
+		if err := v.MarkUsed(sign(priv, stale, fmt.Sprintf("stale-%d", i), body)); err != nil {
+			t.Fatalf("MarkUsed: %v", err)
+		}
+	}
+	if lines := readJournal(t, path); len(lines) != nonceCompactMin {
+		t.Fatalf("в журнале %d строк до сжатия, ожидалось %d", len(lines), nonceCompactMin)
+	}
+
+	fresh := sign(priv, time.Now(), "fresh", body)
+	if err := v.MarkUsed(fresh); err != nil {
+		t.Fatalf("MarkUsed: %v", err)
+	}
+	lines := readJournal(t, path)
+	if len(lines) != 1 || !strings.HasSuffix(lines[0], " fresh") {
+		t.Fatalf("журнал после сжатия: %q", lines)
+	}
+	if v.nonces.lines != 1 {
+		t.Fatalf("счетчик строк после сжатия %d, ожидалось 1", v.nonces.lines)
+	}
+
+	// Журнал после сжатия продолжает дописываться и переживает перезапуск.
+	next := sign(priv, time.Now(), "next", body)
+	if err := v.MarkUsed(next); err != nil {
+		t.Fatalf("MarkUsed: %v", err)
+	}
+	reopened := newTestVerifier(t, pub, path)
+	for _, sig := range []Signature{fresh, next} {
+		if err := reopened.Verify(body, sig); !errors.Is(err, ErrReplayed) {
+			t.Fatalf("nonce %s после перезапуска: %v, ожидалось %v", sig.Nonce, err, ErrReplayed)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("временный файл сжатия не удален: %v", err)
+	}
+}
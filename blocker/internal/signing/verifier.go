@@ -0,0 +1,159 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Заголовки сообщения, в которых observer передает подпись команды.
+const (
+	HeaderSignature = "x-signature"
+	HeaderTimestamp = "x-signature-timestamp"
+	HeaderNonce     = "x-signature-nonce"
+)
+
+// signaturePrefix должен совпадать с префиксом, который использует observer при подписи.
+const signaturePrefix = "remnawave-observer/v1"
+
+// clockSkew — допустимое опережение часов observer относительно ноды.
+const clockSkew = 30 * time.Second
+
+var (
+	// ErrUnsigned означает, что сообщение не содержит подписи.
+	ErrUnsigned = errors.New("сообщение не подписано")
+	// ErrBadSignature означает, что подпись не совпадает с содержимым сообщения.
+	ErrBadSignature = errors.New("подпись сообщения недействительна")
+	// ErrExpired означает, что сообщение подписано слишком давно или время подписи в будущем.
+	ErrExpired = errors.New("время подписи вне допустимого окна")
+	// ErrReplayed означает, что сообщение с таким nonce уже было обработано.
+	ErrReplayed = errors.New("повторное сообщение (nonce уже использован)")
+	// ErrNonceFile означает, что журнал использованных nonce не удалось открыть.
+	ErrNonceFile = errors.New("журнал использованных nonce недоступен")
+)
+
+// Signature — подпись сообщения, извлеченная из его заголовков.
+type Signature struct {
+	Timestamp int64
+	Nonce     string
+	Value     string
+}
+
+// ParseHeaders извлекает подпись из заголовков сообщения. Возвращает ErrUnsigned, если подписи нет.
+func ParseHeaders(headers map[string]interface{}) (Signature, error) {
+	value, _ := headers[HeaderSignature].(string)
+	nonce, _ := headers[HeaderNonce].(string)
+	timestamp, _ := headers[HeaderTimestamp].(string)
+	if value == "" || nonce == "" || timestamp == "" {
+		return Signature{}, ErrUnsigned
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("%w: некорректное время подписи '%s'", ErrBadSignature, timestamp)
+	}
+	return Signature{Timestamp: ts, Nonce: nonce, Value: value}, nil
+}
+
+// Verifier проверяет подписи команд публичным ключом observer и отсекает повторы.
+// Использованные nonce хранятся, пока подпись остается в допустимом окне: в памяти и в журнале
+// на диске, чтобы повтор перехваченной команды отклонялся и после перезапуска блокировщика.
+// Без журнала подписи, сделанные до запуска процесса, считаются устаревшими.
+type Verifier struct {
+	key       ed25519.PublicKey
+	maxAge    time.Duration
+	notBefore time.Time
+
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	nonces *nonceFile
+}
+
+// NewVerifier создает Verifier из публичного ключа в base64. maxAge — максимальный возраст подписи,
+// nonceFile — путь к журналу использованных nonce (пустой — журнал не ведется).
+func NewVerifier(encodedKey string, maxAge time.Duration, nonceFile string) (*Verifier, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("публичный ключ не является base64: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("публичный ключ должен содержать %d байт, получено %d", ed25519.PublicKeySize, len(raw))
+	}
+	v := &Verifier{
+		key:    ed25519.PublicKey(raw),
+		maxAge: maxAge,
+		seen:   make(map[string]time.Time),
+	}
+	if nonceFile == "" {
+		v.notBefore = time.Now()
+		return v, nil
+	}
+	nonces, seen, err := openNonceFile(nonceFile, time.Now().Add(-maxAge-clockSkew))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNonceFile, err)
+	}
+	v.nonces, v.seen = nonces, seen
+	return v, nil
+}
+
+// Verify проверяет подпись, время подписи и то, что nonce еще не использовался.
+// Сам nonce не помечается использованным: это делает MarkUsed после окончательной обработки,
+// чтобы повторные попытки того же сообщения из retry-очереди не считались повтором.
+func (v *Verifier) Verify(body []byte, sig Signature) error {
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil || !ed25519.Verify(v.key, signedMessage(sig.Timestamp, sig.Nonce, body), value) {
+		return ErrBadSignature
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(sig.Timestamp, 0)
+	if signedAt.After(now.Add(clockSkew)) || now.Sub(signedAt) > v.maxAge {
+		return fmt.Errorf("%w: подписано %s", ErrExpired, signedAt.Format(time.RFC3339))
+	}
+	// Без журнала nonce неизвестно, какие команды были обработаны до перезапуска.
+	if signedAt.Before(v.notBefore.Truncate(time.Second)) {
+		return fmt.Errorf("%w: подписано %s, до запуска блокировщика", ErrExpired, signedAt.Format(time.RFC3339))
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.seen[sig.Nonce]; ok {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// MarkUsed запоминает nonce обработанного сообщения и удаляет nonce, вышедшие из окна.
+// Nonce записывается в журнал до возврата, то есть до подтверждения сообщения брокеру.
+func (v *Verifier) MarkUsed(sig Signature) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cutoff := time.Now().Add(-v.maxAge - clockSkew)
+	for nonce, signedAt := range v.seen {
+		if signedAt.Before(cutoff) {
+			delete(v.seen, nonce)
+		}
+	}
+	signedAt := time.Unix(sig.Timestamp, 0)
+	v.seen[sig.Nonce] = signedAt
+
+	if v.nonces == nil {
+		return nil
+	}
+	if v.nonces.needsCompaction(len(v.seen)) {
+		return v.nonces.rewrite(v.seen)
+	}
+	return v.nonces.append(sig.Nonce, signedAt)
+}
+
+// signedMessage собирает байты, которые покрывает подпись (тот же формат, что у observer).
+func signedMessage(timestamp int64, nonce string, body []byte) []byte {
+	header := fmt.Sprintf("%s\n%d\n%s\n", signaturePrefix, timestamp, nonce)
+	return append([]byte(header), body...)
+}
@@ -0,0 +1,325 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testMaxAge = 5 * time.Minute
+
+// testKeys создает пару ключей и возвращает приватный ключ и публичный в base64, как в COMMAND_PUBLIC_KEY.
+func testKeys(t *testing.T) (ed25519.PrivateKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, base64.StdEncoding.EncodeToString(pub)
+}
+
+// sign подписывает тело так же, как observer.
+func sign(priv ed25519.PrivateKey, signedAt time.Time, nonce string, body []byte) Signature {
+	ts := signedAt.Unix()
+	value := ed25519.Sign(priv, signedMessage(ts, nonce, body))
+	return Signature{Timestamp: ts, Nonce: nonce, Value: base64.StdEncoding.EncodeToString(value)}
+}
+
+func newTestVerifier(t *testing.T, encodedKey, nonceFile string) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(encodedKey, testMaxAge, nonceFile)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	priv, pub := testKeys(t)
+	_, otherPub := testKeys(t)
+	body := []byte(`{"ips":["203.0.113.7"],"duration":"5m"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		key     string
+		body    []byte
+		sig     func() Signature
+		wantErr error
+	}{
+		{
+			name: "валидная подпись",
+			key:  pub,
+			body: body,
+			sig:  func() Signature { return sign(priv, now, "nonce-1", body) },
+		},
+		{
+			name:    "измененное тело",
+			key:     pub,
+			body:    []byte(`{"ips":["198.51.100.1"],"duration":"5m"}`),
+			sig:     func() Signature { return sign(priv, now, "nonce-1", body) },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "измененное время",
+			key:  pub,
+			body: body,
+			sig: func() Signature {
+				sig := sign(priv, now, "nonce-1", body)
+				sig.Timestamp++
+				return sig
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "измененный nonce",
+			key:  pub,
+			body: body,
+			sig: func() Signature {
+				sig := sign(priv, now, "nonce-1", body)
+				sig.Nonce = "nonce-2"
+				return sig
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "подпись не в base64",
+			key:  pub,
+			body: body,
+			sig: func() Signature {
+				sig := sign(priv, now, "nonce-1", body)
+				sig.Value = "не base64"
+				return sig
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "чужой ключ",
+			key:     otherPub,
+			body:    body,
+			sig:     func() Signature { return sign(priv, now, "nonce-1", body) },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "устаревшая подпись",
+			key:     pub,
+			body:    body,
+			sig:     func() Signature { return sign(priv, now.Add(-testMaxAge-time.Minute), "nonce-1", body) },
+			wantErr: ErrExpired,
+		},
+		{
+			name: "подпись в пределах расхождения часов",
+			key:  pub,
+			body: body,
+			sig:  func() Signature { return sign(priv, now.Add(clockSkew/2), "nonce-1", body) },
+		},
+		{
+			name:    "подпись из будущего",
+			key:     pub,
+			body:    body,
+			sig:     func() Signature { return sign(priv, now.Add(clockSkew+time.Minute), "nonce-1", body) },
+			wantErr: ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, tt.key, filepath.Join(t.TempDir(), "nonces"))
+			err := v.Verify(tt.body, tt.sig())
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %v, ожидалось %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	full := map[string]interface{}{
+		HeaderSignature: "c2lnbmF0dXJl",
+		HeaderTimestamp: "1700000000",
+		HeaderNonce:     "nonce-1",
+	}
+	without := func(key string) map[string]interface{} {
+		headers := make(map[string]interface{}, len(full))
+		for k, v := range full {
+			if k != key {
+				headers[k] = v
+			}
+		}
+		return headers
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		headers := without(key)
+		headers[key] = value
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]interface{}
+		want    Signature
+		wantErr error
+	}{
+		{
+			name:    "все заголовки",
+			headers: full,
+			want:    Signature{Timestamp: 1700000000, Nonce: "nonce-1", Value: "c2lnbmF0dXJl"},
+		},
+		{name: "без подписи", headers: without(HeaderSignature), wantErr: ErrUnsigned},
+		{name: "без времени", headers: without(HeaderTimestamp), wantErr: ErrUnsigned},
+		{name: "без nonce", headers: without(HeaderNonce), wantErr: ErrUnsigned},
+		{name: "пустые заголовки", headers: nil, wantErr: ErrUnsigned},
+		{name: "время не строкой", headers: with(HeaderTimestamp, int64(1700000000)), wantErr: ErrUnsigned},
+		{name: "некорректное время", headers: with(HeaderTimestamp, "вчера"), wantErr: ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHeaders(tt.headers)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseHeaders = %v, ожидалось %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHeaders: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseHeaders = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	priv, pub := testKeys(t)
+	body := []byte(`{"ips":["203.0.113.7"]}`)
+	sig := sign(priv, time.Now(), "nonce-1", body)
+
+	tests := []struct {
+		name      string
+		nonceFile bool
+		reopen    bool
+	}{
+		{name: "без журнала"},
+		{name: "с журналом", nonceFile: true},
+		{name: "после повторного открытия журнала", nonceFile: true, reopen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.nonceFile {
+				path = filepath.Join(t.TempDir(), "state", "nonces")
+			}
+			v := newTestVerifier(t, pub, path)
+			// Без журнала подписи до запуска отклоняются, поэтому подписываем заново.
+			sig := sig
+			if !tt.nonceFile {
+				sig = sign(priv, time.Now().Add(time.Second), "nonce-1", body)
+			}
+
+			if err := v.Verify(body, sig); err != nil {
+				t.Fatalf("первая проверка: %v", err)
+			}
+			// Повторная попытка до окончательной обработки не считается повтором.
+			if err := v.Verify(body, sig); err != nil {
+				t.Fatalf("проверка до MarkUsed: %v", err)
+			}
+			if err := v.MarkUsed(sig); err != nil {
+				t.Fatalf("MarkUsed: %v", err)
+			}
+			if tt.reopen {
+				v = newTestVerifier(t, pub, path)
+			}
+			if err := v.Verify(body, sig); !errors.Is(err, ErrReplayed) {
+				t.Fatalf("Verify = %v, ожидалось %v", err, ErrReplayed)
+			}
+
+			other := sign(priv, time.Unix(sig.Timestamp, 0), "nonce-2", body)
+			if err := v.Verify(body, other); err != nil {
+				t.Fatalf("другой nonce: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyNotBefore(t *testing.T) {
+	priv, pub := testKeys(t)
+	body := []byte(`{"ips":["203.0.113.7"]}`)
+
+	tests := []struct {
+		name      string
+		nonceFile bool
+		signedAgo time.Duration
+		wantErr   error
+	}{
+		{name: "без журнала, подписано до запуска", signedAgo: time.Minute, wantErr: ErrExpired},
+		{name: "без журнала, подписано после запуска", signedAgo: -time.Second},
+		{name: "с журналом, подписано до запуска", nonceFile: true, signedAgo: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.nonceFile {
+				path = filepath.Join(t.TempDir(), "nonces")
+			}
+			v := newTestVerifier(t, pub, path)
+			sig := sign(priv, time.Now().Add(-tt.signedAgo), "nonce-1", body)
+
+			err := v.Verify(body, sig)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %v, ожидалось %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierKey(t *testing.T) {
+	_, pub := testKeys(t)
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "ключ с пробелами", key: " " + pub + "\n"},
+		{name: "не base64", key: "не ключ", wantErr: true},
+		{name: "неверная длина", key: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVerifier(tt.key, testMaxAge, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewVerifier: ошибка %v, ожидалась ошибка: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierNonceFileUnavailable(t *testing.T) {
+	_, pub := testKeys(t)
+	dir := t.TempDir()
+	// Каталог на месте журнала: открыть его как файл нельзя.
+	path := filepath.Join(dir, "nonces")
+	if err := os.Mkdir(path, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(pub, testMaxAge, path); !errors.Is(err, ErrNonceFile) {
+		t.Fatalf("NewVerifier = %v, ожидалось %v", err, ErrNonceFile)
+	}
+}
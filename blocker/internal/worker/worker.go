@@ -3,60 +3,183 @@ package worker
 import (
 	"blocker-worker/internal/config"
 	"blocker-worker/internal/logger"
+	"blocker-worker/internal/metrics"
+	"blocker-worker/internal/models"
 	"blocker-worker/internal/processor"
+	"blocker-worker/internal/services/firewall"
 	"blocker-worker/internal/services/rabbitmq"
+	"blocker-worker/internal/services/redisstream"
+	"blocker-worker/internal/services/transport"
+	"blocker-worker/internal/signing"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
-
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // Worker — это основная структура приложения.
 type Worker struct {
-	logger    *logger.Logger
-	cfg       *config.Config
-	processor *processor.MessageProcessor
-	ctx       context.Context
-	cancel    context.CancelFunc
+	logger         *logger.Logger
+	cfg            *config.Config
+	processor      *processor.MessageProcessor
+	firewall       firewall.Backend
+	metrics        *metrics.Blocker
+	verifier       *signing.Verifier
+	firewallReady  atomic.Bool
+	consumerActive atomic.Bool
+	ctx            context.Context
+	cancel         context.CancelFunc
 }
 
-// New создает нового Worker'а.
-func New(l *logger.Logger, cfg *config.Config, proc *processor.MessageProcessor) *Worker {
+// New создает нового Worker'а. verifier может быть nil — тогда подписи команд не проверяются.
+func New(l *logger.Logger, cfg *config.Config, proc *processor.MessageProcessor, fw firewall.Backend, verifier *signing.Verifier, m *metrics.Blocker) *Worker {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Worker{
 		logger:    l,
 		cfg:       cfg,
 		processor: proc,
+		firewall:  fw,
+		metrics:   m,
+		verifier:  verifier,
 		ctx:       ctx,
 		cancel:    cancel,
 	}
 }
 
-// handleMessage является функцией обратного вызова для потребителя RabbitMQ.
-func (w *Worker) handleMessage(ctx context.Context, msg amqp.Delivery) error {
-	err := w.processor.Process(ctx, msg.Body)
-	if err != nil {
-		w.logger.Error(fmt.Sprintf("Произошла ошибка при обработке сообщения: %v. Сообщение не будет подтверждено.", err))
-		if errNack := msg.Nack(false, false); errNack != nil {
-			w.logger.Error(fmt.Sprintf("Ошибка при Nack сообщения: %v", errNack))
+// handleMessage является функцией обратного вызова для потребителя команд.
+// Неподписанные, поддельные и повторные сообщения, а также некорректные команды сразу уходят
+// в dead-letter очередь. Подлинные, но устаревшие команды (например, накопившиеся в очереди,
+// пока нода была выключена) подтверждаются без применения: актуальные блокировки приходят
+// в снимке при подключении. Если часть IP не удалось применить, сообщение откладывается
+// в retry-очередь, пока не исчерпан лимит попыток.
+func (w *Worker) handleMessage(ctx context.Context, consumer transport.Consumer, msg transport.Delivery) error {
+	w.metrics.MessagesReceived.Inc()
+
+	sig, err := w.verify(msg.Body(), msg.Headers())
+	if errors.Is(err, signing.ErrExpired) {
+		w.metrics.MessagesExpired.Inc()
+		w.logger.Warning(fmt.Sprintf("Команда пропущена: %v. Актуальные блокировки применяются из снимка.", err))
+		if errAck := msg.Ack(); errAck != nil {
+			w.logger.Error(fmt.Sprintf("Ошибка при Ack сообщения: %v", errAck))
+			return errAck
 		}
+		w.metrics.MessagesAcked.Inc()
+		return nil
+	}
+	if err != nil {
+		w.metrics.MessagesRejected.Inc()
+		w.logger.Error(fmt.Sprintf("Команда отклонена: %v. Сообщение отправлено в dead-letter очередь.", err))
+		w.deadLetter(msg)
+		return nil
+	}
+
+	result, err := w.processor.Process(ctx, msg.Body())
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("Произошла ошибка при обработке сообщения: %v. Сообщение отправлено в dead-letter очередь.", err))
+		w.markUsed(sig)
+		w.deadLetter(msg)
 		return nil
 	}
 
-	if errAck := msg.Ack(false); errAck != nil {
+	w.reportResult(ctx, consumer, result)
+
+	if len(result.FailedIPs) > 0 {
+		return w.retryOrDeadLetter(ctx, msg, result, sig)
+	}
+
+	w.markUsed(sig)
+	if errAck := msg.Ack(); errAck != nil {
 		w.logger.Error(fmt.Sprintf("Ошибка при Ack сообщения: %v", errAck))
 		return errAck
 	}
+	w.metrics.MessagesAcked.Inc()
+	return nil
+}
+
+// retryOrDeadLetter откладывает сообщение для повторной попытки или, если попытки
+// исчерпаны, отправляет его в dead-letter очередь.
+func (w *Worker) retryOrDeadLetter(ctx context.Context, msg transport.Delivery, result *models.BlockResult, sig *signing.Signature) error {
+	attempt := msg.RetryCount() + 1
+	if attempt > w.cfg.MaxRetries {
+		w.logger.Error(fmt.Sprintf("Блокировка %s не применена для %d IP после %d попыток. Сообщение отправлено в dead-letter очередь.",
+			result.BlockID, len(result.FailedIPs), w.cfg.MaxRetries))
+		w.markUsed(sig)
+		w.deadLetter(msg)
+		return nil
+	}
+
+	if err := msg.Retry(ctx, attempt); err != nil {
+		// Транспорт вернул сообщение в очередь: nonce не запоминаем, чтобы повторная доставка прошла проверку.
+		w.logger.Error(fmt.Sprintf("Не удалось отложить повторную попытку: %v. Сообщение возвращено в очередь.", err))
+		return nil
+	}
+
+	w.logger.Warning(fmt.Sprintf("Блокировка %s не применена для %d IP, повторная попытка %d/%d через %v.",
+		result.BlockID, len(result.FailedIPs), attempt, w.cfg.MaxRetries, w.cfg.RetryDelay))
+	w.metrics.MessagesRetried.Inc()
 	return nil
 }
 
-// Run запускает воркер, обрабатывает корректное завершение и переподключения к RabbitMQ.
+// verify проверяет подпись сообщения, если проверка включена. Возвращает nil-подпись, когда она выключена.
+func (w *Worker) verify(body []byte, headers map[string]interface{}) (*signing.Signature, error) {
+	if w.verifier == nil {
+		return nil, nil
+	}
+	sig, err := signing.ParseHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.verifier.Verify(body, sig); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+// markUsed запоминает nonce окончательно обработанного сообщения, чтобы отклонять его повторы.
+func (w *Worker) markUsed(sig *signing.Signature) {
+	if sig == nil {
+		return
+	}
+	if err := w.verifier.MarkUsed(*sig); err != nil {
+		w.logger.Error(fmt.Sprintf("Не удалось сохранить использованный nonce: %v", err))
+	}
+}
+
+// deadLetter убирает сообщение из обработки в dead-letter очередь (или поток) транспорта.
+func (w *Worker) deadLetter(msg transport.Delivery) {
+	if errNack := msg.DeadLetter(); errNack != nil {
+		w.logger.Error(fmt.Sprintf("Ошибка при отправке сообщения в dead-letter: %v", errNack))
+		return
+	}
+	w.metrics.MessagesNacked.Inc()
+}
+
+// reportResult отправляет observer'у результат применения команды на этой ноде.
+func (w *Worker) reportResult(ctx context.Context, consumer transport.Consumer, result *models.BlockResult) {
+	result.NodeID = w.cfg.NodeID
+	body, err := json.Marshal(result)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("Ошибка сериализации результата блокировки: %v", err))
+		return
+	}
+	if err := consumer.PublishResult(ctx, body); err != nil {
+		w.logger.Warning(fmt.Sprintf("Не удалось отправить результат блокировки %s: %v", result.BlockID, err))
+	}
+}
+
+// Stop останавливает воркер так же, как сигнал завершения.
+func (w *Worker) Stop() {
+	w.cancel()
+}
+
+// Run запускает воркер, обрабатывает корректное завершение и переподключения к брокеру.
 func (w *Worker) Run() {
-	w.logger.Info("Запуск Blocker Worker...")
+	w.logger.Info(fmt.Sprintf("Запуск Blocker Worker (нода %s)...", w.cfg.NodeID))
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -66,24 +189,34 @@ func (w *Worker) Run() {
 		w.cancel()
 	}()
 
-	for {
+	// Не подключаемся к брокеру, пока blacklist недоступен: команды дождутся в очереди ноды.
+	if !w.ensureFirewall() {
+		w.logger.Info("Воркер остановлен.")
+		return
+	}
+	go w.monitorFirewall()
+
+	for attempt := 0; ; attempt++ {
 		select {
 		case <-w.ctx.Done():
 			w.logger.Info("Воркер остановлен.")
 			return
 		default:
-			consumer := rabbitmq.NewConsumer(w.logger, w.cfg.RabbitMQURL)
+			if attempt > 0 {
+				w.metrics.Reconnects.Inc()
+			}
+			consumer := w.newConsumer()
 			if err := consumer.Connect(); err != nil {
-				w.logger.Warning(fmt.Sprintf("Не удалось подключиться к RabbitMQ: %v. Повторная попытка через %v...", err, w.cfg.ReconnectDelay))
+				w.logger.Warning(fmt.Sprintf("Не удалось подключиться к брокеру (%s): %v. Повторная попытка через %v...", w.cfg.Transport, err, w.cfg.ReconnectDelay))
 				w.waitOrExit()
 				continue
 			}
 
-			err := consumer.SetupAndConsume(w.ctx, w.handleMessage)
+			err := w.consume(consumer)
 			consumer.Close()
 
 			if err != nil {
-				w.logger.Warning(fmt.Sprintf("Соединение с RabbitMQ потеряно: %v. Повторная попытка через %v...", err, w.cfg.ReconnectDelay))
+				w.logger.Warning(fmt.Sprintf("Соединение с брокером (%s) потеряно: %v. Повторная попытка через %v...", w.cfg.Transport, err, w.cfg.ReconnectDelay))
 			}
 
 			w.waitOrExit()
@@ -91,6 +224,158 @@ func (w *Worker) Run() {
 	}
 }
 
+// newConsumer создает потребителя выбранного в конфигурации транспорта.
+func (w *Worker) newConsumer() transport.Consumer {
+	if w.cfg.Transport == transport.Redis {
+		return redisstream.NewConsumer(w.logger, w.cfg)
+	}
+	return rabbitmq.NewConsumer(w.logger, w.cfg)
+}
+
+// consume настраивает очередь, синхронизирует blacklist по снимку observer и начинает потребление.
+// Очередь привязывается до запроса снимка, чтобы команды, пришедшие во время синхронизации, не потерялись.
+func (w *Worker) consume(consumer transport.Consumer) error {
+	if err := consumer.Setup(); err != nil {
+		return err
+	}
+
+	w.reconcile(consumer)
+
+	w.consumerActive.Store(true)
+	defer w.consumerActive.Store(false)
+
+	return consumer.Consume(w.ctx, func(ctx context.Context, msg transport.Delivery) error {
+		return w.handleMessage(ctx, consumer, msg)
+	})
+}
+
+// reconcile запрашивает снимок активных блокировок и применяет их с оставшимся сроком.
+// Ошибка синхронизации не мешает дальнейшей обработке новых команд.
+func (w *Worker) reconcile(consumer transport.Consumer) {
+	reply, err := consumer.RequestSnapshot(w.ctx)
+	if err != nil {
+		w.logger.Warning(fmt.Sprintf("Не удалось получить снимок активных блокировок: %v", err))
+		return
+	}
+
+	sig, err := w.verify(reply.Body, reply.Headers)
+	if err != nil {
+		w.metrics.MessagesRejected.Inc()
+		w.logger.Error(fmt.Sprintf("Снимок активных блокировок отклонен: %v", err))
+		return
+	}
+	w.markUsed(sig)
+
+	result, err := w.processor.ApplySnapshot(w.ctx, reply.Body)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("Не удалось применить снимок активных блокировок: %v", err))
+		return
+	}
+	w.logger.Info(fmt.Sprintf("Синхронизация завершена: применено %d IP, ошибок %d.", len(result.AppliedIPs), len(result.FailedIPs)))
+}
+
+// ConsumerActive сообщает, потребляет ли воркер команды из очереди ноды.
+func (w *Worker) ConsumerActive() bool {
+	return w.consumerActive.Load()
+}
+
+// EnforcingStatus сообщает, готова ли нода применять блокировки: команды потребляются
+// и blacklist доступен. Используется как проверка готовности "enforcing".
+func (w *Worker) EnforcingStatus() (bool, string) {
+	switch {
+	case !w.FirewallReady():
+		return false, "blacklist недоступен"
+	case !w.ConsumerActive():
+		return false, "нет соединения с брокером"
+	default:
+		return true, ""
+	}
+}
+
+// FirewallReady сообщает, прошли ли set'ы blacklist последнюю проверку.
+func (w *Worker) FirewallReady() bool {
+	return w.firewallReady.Load()
+}
+
+// ensureFirewall повторяет проверку (и при разрешении — создание) set'ов blacklist,
+// пока она не пройдет. Возвращает false, если воркер остановлен раньше.
+func (w *Worker) ensureFirewall() bool {
+	for {
+		err := w.checkFirewall()
+		if err == nil {
+			w.logger.Info("Set'ы blacklist проверены и готовы к работе.")
+			return true
+		}
+		w.logger.Error(fmt.Sprintf("Blacklist недоступен: %v. Повторная проверка через %v...", err, w.cfg.ReconnectDelay))
+
+		select {
+		case <-w.ctx.Done():
+			return false
+		case <-time.After(w.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// monitorFirewall периодически перепроверяет set'ы blacklist, чтобы состояние готовности
+// отражало удаление таблицы или set'а во время работы, и обновляет метрику размера blacklist.
+func (w *Worker) monitorFirewall() {
+	ticker := time.NewTicker(w.cfg.FirewallCheckPeriod)
+	defer ticker.Stop()
+
+	w.updateBlacklistSize()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			wasReady := w.FirewallReady()
+			err := w.checkFirewall()
+			if err != nil && wasReady {
+				w.logger.Error(fmt.Sprintf("Blacklist стал недоступен: %v", err))
+			}
+			if err == nil && !wasReady {
+				w.logger.Info("Blacklist снова доступен.")
+			}
+			if err == nil {
+				w.updateBlacklistSize()
+			}
+		}
+	}
+}
+
+// updateBlacklistSize обновляет метрику текущего числа элементов в blacklist.
+func (w *Worker) updateBlacklistSize() {
+	ctx, cancel := context.WithTimeout(w.ctx, 10*time.Second)
+	defer cancel()
+
+	entries, err := w.firewall.List(ctx)
+	if err != nil {
+		w.logger.Warning(fmt.Sprintf("Не удалось получить размер blacklist: %v", err))
+		return
+	}
+	w.metrics.BlacklistSize.Set(int64(len(entries)))
+}
+
+// checkFirewall проверяет set'ы blacklist и создает их, если это разрешено конфигурацией.
+func (w *Worker) checkFirewall() error {
+	ctx, cancel := context.WithTimeout(w.ctx, 10*time.Second)
+	defer cancel()
+
+	err := w.firewall.Check(ctx)
+	if err != nil && w.cfg.FirewallAutoCreate {
+		w.logger.Warning(fmt.Sprintf("Blacklist не готов (%v), создаем таблицу и set'ы...", err))
+		if errProvision := w.firewall.Provision(ctx); errProvision != nil {
+			err = fmt.Errorf("%v; автосоздание не удалось: %w", err, errProvision)
+		} else {
+			w.logger.Warning("Set'ы blacklist созданы. Убедитесь, что правила файрвола отбрасывают трафик из них.")
+			err = w.firewall.Check(ctx)
+		}
+	}
+
+	w.firewallReady.Store(err == nil)
+	return err
+}
+
 // waitOrExit приостанавливает выполнение на время задержки переподключения, но немедленно выходит, если контекст отменен.
 func (w *Worker) waitOrExit() {
 	select {
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -12,55 +15,116 @@ import (
 
 	"observer_service/internal/api"
 	"observer_service/internal/config"
+	"observer_service/internal/metrics"
 	"observer_service/internal/monitor"
 	"observer_service/internal/processor"
 	"observer_service/internal/services/alerter"
+	"observer_service/internal/services/feedback"
 	"observer_service/internal/services/publisher"
+	"observer_service/internal/services/signing"
 	"observer_service/internal/services/storage"
+	"observer_service/internal/services/tracker"
+	"observer_service/internal/syslog"
 )
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	// Служебная команда keygen: генерирует пару ключей для подписи команд блокировки.
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		privateKey, publicKey, err := signing.GenerateKey()
+		if err != nil {
+			log.Fatalf("Не удалось сгенерировать ключи: %v", err)
+		}
+		fmt.Printf("COMMAND_SIGNING_KEY=%s\nCOMMAND_PUBLIC_KEY=%s\n", privateKey, publicKey)
+		return
+	}
+
 	cfg := config.New()
 
-	// Контекст для сигнализации о завершении работы фоновых процессов
+	// Остановка выполняется по фазам, поэтому у приема логов, их обработки и остальных
+	// фоновых процессов свои контексты и WaitGroup.
 	ctx, cancel := context.WithCancel(context.Background())
-	// WaitGroup для ожидания завершения всех фоновых горутин
-	var wg sync.WaitGroup
+	ingestCtx, ingestCancel := context.WithCancel(context.Background())
+	processingCtx, processingCancel := context.WithCancel(context.Background())
+	var wg, ingestWg, processingWg sync.WaitGroup
 
-	redisStore, err := storage.NewRedisStore(ctx, cfg.RedisURL, "internal/scripts/add_and_check_ip.lua")
+	redisStore, err := storage.NewRedisStore(ctx, cfg.RedisMode, cfg.RedisURL, "internal/scripts/add_and_check_ip.lua")
 	if err != nil {
 		log.Fatalf("Критическая ошибка: не удалось подключиться к Redis: %v", err)
 	}
 	defer redisStore.Close()
 
-	rabbitPublisher, err := publisher.NewRabbitMQPublisher(cfg.RabbitMQURL, cfg.BlockingExchangeName)
+	ipStore, err := newIPStorage(cfg, redisStore)
 	if err != nil {
-		log.Fatalf("Критическая ошибка: не удалось подключиться к RabbitMQ: %v", err)
+		log.Fatalf("Критическая ошибка: %v", err)
+	}
+	if ipStore != storage.IPStorage(redisStore) {
+		defer ipStore.Close()
 	}
-	defer rabbitPublisher.Close()
+
+	signer, err := newSigner(cfg)
+	if err != nil {
+		log.Fatalf("Критическая ошибка: %v", err)
+	}
+
+	blockTracker := tracker.NewBlockTracker(redisStore, cfg.ExpectedNodes, cfg.KnownNodeTTL)
+	blockPublisher, resultConsumer, snapshotServer, err := newTransport(cfg, redisStore, blockTracker, signer)
+	if err != nil {
+		log.Fatalf("Критическая ошибка: %v", err)
+	}
+	// Сообщения о блокировке сначала сохраняются в outbox в Redis и публикуются асинхронно.
+	blockOutbox := publisher.NewOutbox(redisStore, blockPublisher)
+	defer blockOutbox.Close()
 
 	webhookAlerter := alerter.NewWebhookAlerter(cfg.AlertWebhookURL)
 
-	logProcessor := processor.NewLogProcessor(redisStore, rabbitPublisher, webhookAlerter, cfg)
-	poolMonitor := monitor.NewPoolMonitor(redisStore, cfg)
-	apiServer := api.NewServer(cfg.Port, logProcessor, redisStore, rabbitPublisher)
+	registry := metrics.NewRegistry()
+	logProcessor := processor.NewLogProcessor(ipStore, redisStore, redisStore, blockOutbox, webhookAlerter, blockTracker, cfg, metrics.NewProcessor(registry, cfg.WorkerPoolSize))
+	poolMonitor := monitor.NewPoolMonitor(ipStore, cfg)
+	apiServer := api.NewServer(cfg, logProcessor, ipStore, redisStore, blockOutbox, blockTracker, registry)
+
+	processingWg.Add(2)
+	go logProcessor.StartWorkerPool(processingCtx, &processingWg)
+	go logProcessor.StartSideEffectWorkerPool(processingCtx, &processingWg)
 
-	// Сообщаем WaitGroup, что будем ждать три горутины
-	wg.Add(3)
+	wg.Add(4)
 	go poolMonitor.Run(ctx, &wg)
-	go logProcessor.StartWorkerPool(ctx, &wg)
-	go logProcessor.StartSideEffectWorkerPool(ctx, &wg) // Запускаем новый пул воркеров
+	go resultConsumer.Run(ctx, &wg)
+	go snapshotServer.Run(ctx, &wg)
+	go blockOutbox.Run(ctx, &wg)
+
+	// Необязательный прием access-логов по syslog напрямую с нод, без Vector и nginx.
+	if cfg.SyslogUDPAddr != "" || cfg.SyslogTCPAddr != "" {
+		syslogListener, err := syslog.NewListener(cfg, logProcessor)
+		if err != nil {
+			log.Fatalf("Критическая ошибка: %v", err)
+		}
+		ingestWg.Add(1)
+		go syslogListener.Run(ingestCtx, &ingestWg)
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
 		Handler: apiServer.GetRouter(), // Получаем роутер из нашего api.Server
 	}
 
+	// С INGEST_TLS_* API обслуживается по HTTPS, а ноды могут аутентифицироваться клиентским сертификатом.
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		log.Fatalf("Критическая ошибка: %v", err)
+	}
+	srv.TLSConfig = tlsConfig
+
 	go func() {
-		log.Printf("Сервер Observer Service запущен на порту %s", cfg.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Сервер Observer Service запущен на порту %s (TLS: %v)", cfg.Port, tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			err = srv.ListenAndServeTLS(cfg.IngestTLSCertFile, cfg.IngestTLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Ошибка запуска сервера: %v", err)
 		}
 	}()
@@ -80,10 +144,115 @@ func main() {
 		log.Println("HTTP-сервер успешно остановлен.")
 	}
 
+	// Фаза 1: прием логов остановлен — HTTP-сервер выше, syslog здесь.
+	ingestCancel()
+	ingestWg.Wait()
+
+	// Фазы 2 и 3: обработка принятых записей и выданных побочных задач с общим дедлайном.
+	// Outbox и остальные фоновые процессы работают, пока обработка не завершится.
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer drainCancel()
+	log.Printf("Обработка принятых записей перед остановкой (не дольше %v)...", cfg.ShutdownTimeout)
+	if !logProcessor.DrainLogs(drainCtx) || !logProcessor.DrainSideEffects(drainCtx) {
+		log.Println("Дедлайн SHUTDOWN_TIMEOUT_SECONDS истек, обработка прерывается.")
+	}
+	processingCancel()
+	processingWg.Wait()
+	if entries, tasks := logProcessor.Dropped(); entries > 0 || tasks > 0 {
+		log.Printf("ВНИМАНИЕ: при остановке не обработано записей логов: %d, побочных задач: %d (задачи останутся в Redis и будут выполнены после перезапуска).", entries, tasks)
+	} else {
+		log.Println("Все принятые записи и побочные задачи обработаны.")
+	}
+
+	// Фаза 4: остановка остальных фоновых процессов; хранилища и издатель закрываются
+	// отложенными вызовами после выхода из main.
 	cancel()
 
 	log.Println("Ожидание завершения фоновых процессов...")
 	wg.Wait()
 
 	log.Println("Все фоновые процессы остановлены. Сервис успешно остановлен.")
-}
\ No newline at end of file
+}
+
+// backgroundService — фоновый компонент, работающий до отмены контекста.
+type backgroundService interface {
+	Run(ctx context.Context, wg *sync.WaitGroup)
+}
+
+// newTransport создает издателя команд, потребителя отчетов и обработчик запросов снимка
+// для выбранного транспорта (RabbitMQ или Redis Streams).
+func newTransport(cfg *config.Config, blocks storage.BlockStore, recorder feedback.ResultRecorder, signer *signing.Signer) (publisher.EventPublisher, backgroundService, backgroundService, error) {
+	if cfg.Transport == "redis" {
+		streamPublisher, err := publisher.NewRedisStreamPublisher(cfg.RedisMode, cfg.RedisURL, cfg.CommandStream, cfg.StreamMaxLen, signer)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("не удалось создать издателя Redis Stream: %w", err)
+		}
+		return streamPublisher,
+			feedback.NewRedisResultConsumer(cfg.RedisMode, cfg.RedisURL, cfg.ResultsStream, cfg.ResultsQueueName, recorder),
+			feedback.NewRedisSnapshotServer(cfg.RedisMode, cfg.RedisURL, cfg.SnapshotRequestsKey, blocks, signer),
+			nil
+	}
+
+	rabbitPublisher, err := publisher.NewRabbitMQPublisher(cfg.RabbitMQURL, cfg.BlockingExchangeName, signer)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("не удалось подключиться к RabbitMQ: %w", err)
+	}
+	return rabbitPublisher,
+		feedback.NewRabbitMQResultConsumer(cfg.RabbitMQURL, cfg.ResultsExchangeName, cfg.ResultsQueueName, recorder),
+		feedback.NewRabbitMQSnapshotServer(cfg.RabbitMQURL, cfg.SnapshotQueueName, blocks, signer),
+		nil
+}
+
+// newIPStorage возвращает хранилище IP пользователей, выбранное в IP_STORAGE. Блокировки, outbox
+// и токены нод по-прежнему хранятся в Redis.
+func newIPStorage(cfg *config.Config, redisStore *storage.RedisStore) (storage.IPStorage, error) {
+	switch cfg.IPStorage {
+	case "memory":
+		log.Println("ВНИМАНИЕ: IP пользователей хранятся в памяти и теряются при перезапуске.")
+		return storage.NewMemoryStore(), nil
+	case "bolt":
+		store, err := storage.NewBoltStore(cfg.IPStoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось открыть IP_STORAGE_PATH: %w", err)
+		}
+		return store, nil
+	default:
+		return redisStore, nil
+	}
+}
+
+// newSigner создает подписчик команд блокировки. Без COMMAND_SIGNING_KEY команды публикуются без подписи.
+func newSigner(cfg *config.Config) (*signing.Signer, error) {
+	if cfg.CommandSigningKey == "" {
+		log.Println("ВНИМАНИЕ: COMMAND_SIGNING_KEY не задан, команды блокировки публикуются без подписи.")
+		return nil, nil
+	}
+	signer, err := signing.NewSigner(cfg.CommandSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный COMMAND_SIGNING_KEY: %w", err)
+	}
+	log.Printf("Команды блокировки подписываются Ed25519, публичный ключ: %s", signer.PublicKey())
+	return signer, nil
+}
+
+// newTLSConfig создает настройки TLS для API. С INGEST_TLS_CLIENT_CA_FILE клиентский сертификат
+// проверяется, если предъявлен: так ноды с сертификатами и ноды с токенами работают через один порт.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.IngestTLSCertFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.IngestTLSClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.IngestTLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать INGEST_TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в INGEST_TLS_CLIENT_CA_FILE нет ни одного сертификата")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
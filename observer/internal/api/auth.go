@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nodeIDKey — ключ контекста gin, под которым сохраняется аутентифицированная нода.
+const nodeIDKey = "node_id"
+
+var nodeIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// bearerToken возвращает токен из заголовка Authorization: Bearer.
+func bearerToken(c *gin.Context) string {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateNode определяет ноду-отправителя по клиентскому сертификату (mTLS, CN — идентификатор
+// ноды) или по токену ноды. Без учетных данных запрос отклоняется, если INGEST_AUTH_REQUIRED включен,
+// а неверный токен отклоняется всегда.
+func (s *Server) authenticateNode(c *gin.Context) {
+	if tlsState := c.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) > 0 {
+		if nodeID := tlsState.PeerCertificates[0].Subject.CommonName; nodeID != "" {
+			s.ingestMetrics.Authenticated.Inc()
+			c.Set(nodeIDKey, nodeID)
+			c.Next()
+			return
+		}
+	}
+
+	token := bearerToken(c)
+	if token == "" {
+		if s.cfg.IngestAuthRequired {
+			s.ingestMetrics.RejectedNoAuth.Inc()
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "node credentials are required"})
+			return
+		}
+		c.Next()
+		return
+	}
+
+	nodeID, ok, err := s.nodes.AuthenticateNodeToken(c.Request.Context(), token)
+	if err != nil {
+		log.Printf("Ошибка проверки токена ноды: %v", err)
+		s.ingestMetrics.RejectedStoreError.Inc()
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify node credentials"})
+		return
+	}
+	if !ok {
+		s.ingestMetrics.RejectedBadToken.Inc()
+		log.Printf("Warning: отклонен запрос с неизвестным или отозванным токеном ноды с адреса %s", c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or revoked node token"})
+		return
+	}
+
+	s.ingestMetrics.Authenticated.Inc()
+	c.Set(nodeIDKey, nodeID)
+	c.Next()
+}
+
+// requireAdmin пропускает только запросы с ADMIN_TOKEN. Без ADMIN_TOKEN административный API выключен.
+func (s *Server) requireAdmin(c *gin.Context) {
+	if s.cfg.AdminToken == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "admin API is disabled"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(bearerToken(c)), []byte(s.cfg.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) handleListNodes(c *gin.Context) {
+	credentials, err := s.nodes.ListNodeCredentials(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nodes": credentials})
+}
+
+// handleIssueNodeToken выпускает (или перевыпускает) токен ноды. Токен показывается только в этом ответе.
+func (s *Server) handleIssueNodeToken(c *gin.Context) {
+	nodeID := c.Param("id")
+	if !nodeIDPattern.MatchString(nodeID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node id must be 1-64 characters of A-Z, a-z, 0-9, '.', '_' or '-'"})
+		return
+	}
+
+	token, err := s.nodes.IssueNodeToken(c.Request.Context(), nodeID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Выпущен новый токен для ноды %s", nodeID)
+	c.JSON(http.StatusCreated, gin.H{"node_id": nodeID, "token": token})
+}
+
+func (s *Server) handleRevokeNodeToken(c *gin.Context) {
+	nodeID := c.Param("id")
+	revoked, err := s.nodes.RevokeNodeToken(c.Request.Context(), nodeID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node has no token"})
+		return
+	}
+	log.Printf("Токен ноды %s отозван", nodeID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"observer_service/internal/models"
+	"observer_service/internal/processor"
+	"strings"
+	"unicode"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ingestChunkSize — сколько записей передается в обработчик за раз.
+	ingestChunkSize = 500
+	// maxListedRejects ограничивает число отклоненных записей, перечисляемых в ответе.
+	maxListedRejects = 100
+	// maxEmailLength ограничивает длину идентификатора пользователя.
+	maxEmailLength = 256
+)
+
+var (
+	errBodyTooLarge        = errors.New("request body is too large")
+	errBatchTooLarge       = errors.New("batch has too many entries")
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+)
+
+// rejectedEntry описывает запись, не прошедшую проверку.
+type rejectedEntry struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// ingestResult — итог разбора тела запроса.
+type ingestResult struct {
+	accepted      int
+	rejected      []rejectedEntry
+	rejectedTotal int // Всего отклоненных записей (в rejected перечислены первые maxListedRejects)
+}
+
+func (r *ingestResult) reject(index int, reason string) {
+	r.rejectedTotal++
+	if len(r.rejected) < maxListedRejects {
+		r.rejected = append(r.rejected, rejectedEntry{Index: index, Reason: reason})
+	}
+}
+
+// limitedReader возвращает errBodyTooLarge, если из источника прочитано больше limit байт.
+// В отличие от io.LimitReader, превышение не выглядит как обычный конец данных.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.limit < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.limit+1 {
+		p = p[:l.limit+1]
+	}
+	n, err := l.r.Read(p)
+	l.limit -= int64(n)
+	if l.limit < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// newBodyReader снимает Content-Encoding (gzip или zstd) и ограничивает размер распакованных данных.
+func newBodyReader(body io.Reader, encoding string, maxBytes int64) (io.Reader, func(), error) {
+	noop := func() {}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return &limitedReader{r: body, limit: maxBytes}, noop, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, noop, fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		return &limitedReader{r: zr, limit: maxBytes}, func() { zr.Close() }, nil
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+		if err != nil {
+			return nil, noop, fmt.Errorf("invalid zstd stream: %w", err)
+		}
+		return &limitedReader{r: zr, limit: maxBytes}, zr.Close, nil
+	default:
+		return nil, noop, errUnsupportedEncoding
+	}
+}
+
+// decodeEntries разбирает тело запроса по мере чтения: JSON-массив записей или NDJSON
+// (по одной записи на строку). Некорректные записи попадают в список отклоненных и не прерывают
+// разбор остальных. Проверенные записи буферизуются (не больше maxEntries) и передаются в emit
+// пачками по ingestChunkSize только после разбора всего тела: если тело или пакет превышают лимиты
+// или тело повреждено, ни одна запись не принимается, и клиент может безопасно отправить пакет заново.
+// Ошибка возвращается, только если продолжить разбор невозможно.
+func decodeEntries(body io.Reader, maxEntries int, emit func([]models.LogEntry) error) (ingestResult, error) {
+	var result ingestResult
+	reader := bufio.NewReader(body)
+	var entries []models.LogEntry
+	index := 0
+
+	handle := func(raw []byte) error {
+		if index >= maxEntries {
+			return errBatchTooLarge
+		}
+		entry, err := parseEntry(raw)
+		if err != nil {
+			result.reject(index, err.Error())
+		} else {
+			entries = append(entries, entry)
+		}
+		index++
+		return nil
+	}
+
+	first, err := peekNonSpace(reader)
+	switch {
+	case errors.Is(err, io.EOF):
+		return result, nil
+	case err != nil:
+		return result, err
+	case first == '[':
+		err = decodeArray(reader, handle)
+	default:
+		err = decodeLines(reader, handle)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// При переполнении части шардов принятые записи все равно учитываются, а передача останавливается.
+	for start := 0; start < len(entries); start += ingestChunkSize {
+		chunk := entries[start:min(start+ingestChunkSize, len(entries))]
+		err := emit(chunk)
+		var bp *processor.BackpressureError
+		switch {
+		case err == nil:
+			result.accepted += len(chunk)
+		case errors.As(err, &bp):
+			result.accepted += bp.Accepted
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// decodeArray разбирает JSON-массив записей, не загружая его в память целиком.
+// Синтаксическая ошибка прерывает разбор: границы следующих записей уже не определить.
+func decodeArray(reader io.Reader, handle func([]byte) error) error {
+	dec := json.NewDecoder(reader)
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("invalid JSON array: %w", err)
+		}
+		if err := handle(raw); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+	return nil
+}
+
+// decodeLines разбирает NDJSON: каждая строка — отдельная запись, пустые строки пропускаются.
+// Некорректная строка отклоняется, не затрагивая соседние.
+func decodeLines(reader *bufio.Reader, handle func([]byte) error) error {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if handleErr := handle(line); handleErr != nil {
+				return handleErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// peekNonSpace пропускает пробельные символы и возвращает первый значимый байт, не извлекая его.
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			return b[0], nil
+		}
+		if _, err := reader.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parseEntry декодирует и проверяет одну запись. IP-адрес приводится к канонической форме.
+// Неизвестные поля (например, timestamp от агента ноды) допускаются.
+func parseEntry(raw []byte) (models.LogEntry, error) {
+	var entry models.LogEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return entry, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	entry.UserEmail = strings.TrimSpace(entry.UserEmail)
+	switch {
+	case entry.UserEmail == "":
+		return entry, errors.New("user_email is required")
+	case len(entry.UserEmail) > maxEmailLength:
+		return entry, fmt.Errorf("user_email is longer than %d bytes", maxEmailLength)
+	case strings.IndexFunc(entry.UserEmail, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		return entry, errors.New("user_email contains whitespace or control characters")
+	}
+
+	if entry.SourceIP == "" {
+		return entry, errors.New("source_ip is required")
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(entry.SourceIP))
+	if err != nil || ip.Zone() != "" {
+		return entry, fmt.Errorf("source_ip '%s' is not a valid IP address", entry.SourceIP)
+	}
+	entry.SourceIP = ip.Unmap().String()
+	return entry, nil
+}
@@ -2,37 +2,51 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"observer_service/internal/config"
+	"observer_service/internal/metrics"
 	"observer_service/internal/models"
 	"observer_service/internal/processor"
 	"observer_service/internal/services/publisher"
 	"observer_service/internal/services/storage"
+	"observer_service/internal/services/tracker"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	router    *gin.Engine
-	processor *processor.LogProcessor
-	storage   storage.IPStorage
-	publisher publisher.EventPublisher
-	port      string
+	router        *gin.Engine
+	processor     *processor.LogProcessor
+	storage       storage.IPStorage
+	nodes         storage.NodeTokenStore
+	publisher     publisher.EventPublisher
+	tracker       *tracker.BlockTracker
+	registry      *metrics.Registry
+	ingestMetrics *metrics.Ingest
+	cfg           *config.Config
 }
 
-func NewServer(port string, proc *processor.LogProcessor, storage storage.IPStorage, pub publisher.EventPublisher) *Server {
+func NewServer(cfg *config.Config, proc *processor.LogProcessor, storage storage.IPStorage, nodes storage.NodeTokenStore, pub publisher.EventPublisher, t *tracker.BlockTracker, registry *metrics.Registry) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
 	s := &Server{
-		router:    router,
-		processor: proc,
-		storage:   storage,
-		publisher: pub,
-		port:      port,
+		router:        router,
+		processor:     proc,
+		storage:       storage,
+		nodes:         nodes,
+		publisher:     pub,
+		tracker:       t,
+		registry:      registry,
+		ingestMetrics: metrics.NewIngest(registry),
+		cfg:           cfg,
 	}
 
 	s.setupRoutes()
@@ -44,43 +58,141 @@ func (s *Server) GetRouter() *gin.Engine {
 }
 
 func (s *Server) setupRoutes() {
-	s.router.POST("/log-entry", s.handleProcessLogEntries)
+	s.router.POST("/log-entry", s.authenticateNode, s.handleProcessLogEntries)
 	s.router.GET("/health", s.handleHealthCheck)
+
+	// Метрики и статусы блокировок содержат email и IP пользователей, поэтому доступны
+	// только с ADMIN_TOKEN, хотя и обслуживаются на том же порту, что и прием логов.
+	admin := s.router.Group("/admin", s.requireAdmin)
+	admin.GET("/metrics", s.handleMetrics)
+	admin.GET("/blocks", s.handleListBlocks)
+	admin.GET("/blocks/:id", s.handleGetBlock)
+	admin.GET("/users", s.handleListUsers)
+	admin.GET("/nodes", s.handleListNodes)
+	admin.POST("/nodes/:id/token", s.handleIssueNodeToken)
+	admin.DELETE("/nodes/:id/token", s.handleRevokeNodeToken)
 }
 
 func (s *Server) Run() error {
-	return s.router.Run(":" + s.port)
+	return s.router.Run(":" + s.cfg.Port)
 }
 
+// handleProcessLogEntries принимает записи логов JSON-массивом или NDJSON, в том числе
+// сжатые gzip или zstd. Проверенные записи буферизуются и передаются в обработчик пачками
+// только после разбора всего тела; некорректные записи перечисляются в ответе и не мешают принять остальные.
 func (s *Server) handleProcessLogEntries(c *gin.Context) {
-	var entries []models.LogEntry
-	if err := c.ShouldBindJSON(&entries); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, s.cfg.IngestMaxBodyBytes)
+	reader, closeReader, err := newBodyReader(body, c.GetHeader("Content-Encoding"), s.cfg.IngestMaxBodyBytes)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUnsupportedEncoding) {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	defer closeReader()
+
+	// Записи помечаются только аутентифицированной нодой. Заголовку X-Node-ID и полю node_id
+	// в записях не доверяем: без аутентификации их может подставить кто угодно.
+	nodeID := c.GetString(nodeIDKey)
+	result, err := decodeEntries(reader, s.cfg.IngestMaxBatchEntries, func(entries []models.LogEntry) error {
+		for i := range entries {
+			entries[i].NodeID = nodeID
+		}
+		return s.processor.EnqueueEntries(entries)
+	})
+
+	s.ingestMetrics.EntriesAccepted.Add(result.accepted)
+	s.ingestMetrics.EntriesRejected.Add(result.rejectedTotal)
+
+	response := gin.H{
+		"processed_entries": result.accepted,
+		"rejected_entries":  result.rejectedTotal,
+	}
+	if len(result.rejected) > 0 {
+		response["rejected"] = result.rejected
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, processor.ErrQueueFull):
+		log.Printf("Warning: log shard queues are full. Rejecting remaining entries after %d accepted. Error: %v", result.accepted, err)
+		response["error"] = "Service is temporarily overloaded. Please try again later."
+		c.JSON(http.StatusServiceUnavailable, response)
+	case errors.Is(err, errBodyTooLarge), errors.As(err, &maxBytesErr):
+		response["error"] = fmt.Sprintf("request body exceeds %d bytes", s.cfg.IngestMaxBodyBytes)
+		c.JSON(http.StatusRequestEntityTooLarge, response)
+	case errors.Is(err, errBatchTooLarge):
+		response["error"] = fmt.Sprintf("batch exceeds %d entries", s.cfg.IngestMaxBatchEntries)
+		c.JSON(http.StatusRequestEntityTooLarge, response)
+	case err != nil:
+		response["error"] = err.Error()
+		c.JSON(http.StatusBadRequest, response)
+	case result.accepted == 0 && result.rejectedTotal > 0:
+		response["error"] = "all entries were rejected"
+		c.JSON(http.StatusBadRequest, response)
+	default:
+		response["status"] = "accepted"
+		c.JSON(http.StatusAccepted, response)
+	}
+}
 
-	if err := s.processor.EnqueueEntries(entries); err != nil {
-		log.Printf("Warning: log queue is full. Rejecting request for %d entries. Error: %v", len(entries), err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Service is temporarily overloaded. Please try again later.",
-		})
+func (s *Server) handleListBlocks(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
 		return
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{
-		"status":            "accepted",
-		"processed_entries": len(entries),
+	nodes, err := s.tracker.NodeIDs(c.Request.Context())
+	if err != nil {
+		log.Printf("Ошибка чтения списка нод: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read block status"})
+		return
+	}
+	blocks, err := s.tracker.Recent(c.Request.Context(), limit)
+	if err != nil {
+		log.Printf("Ошибка чтения состояния блокировок: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read block status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"known_nodes": nodes,
+		"blocks":      blocks,
 	})
 }
 
+func (s *Server) handleGetBlock(c *gin.Context) {
+	status, ok, err := s.tracker.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Ошибка чтения состояния блокировки %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read block status"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (s *Server) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	_, _ = s.registry.WriteTo(c.Writer)
+}
+
 func (s *Server) handleHealthCheck(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	status := http.StatusOK
 	response := gin.H{
-		"redis_connection":    "ok",
-		"rabbitmq_connection": "ok",
+		"redis_connection": "ok",
+		"transport":        "ok",
+		"transport_type":   s.cfg.Transport,
 	}
 
 	// Check Redis
@@ -89,10 +201,10 @@ func (s *Server) handleHealthCheck(c *gin.Context) {
 		response["redis_connection"] = "failed"
 	}
 
-	// Check RabbitMQ
+	// Check the active command transport (RabbitMQ or Redis Streams)
 	if err := s.publisher.Ping(); err != nil {
 		status = http.StatusServiceUnavailable
-		response["rabbitmq_connection"] = "failed"
+		response["transport"] = "failed"
 	}
 
 	if status == http.StatusOK {
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"observer_service/internal/services/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUsersPageSize ограничивает размер страницы списка пользователей.
+const maxUsersPageSize = 1000
+
+// handleListUsers возвращает страницу индекса активных пользователей. Обход продолжается
+// запросами с cursor из next_cursor, пока он не станет пустым.
+func (s *Server) handleListUsers(c *gin.Context) {
+	count, err := strconv.Atoi(c.DefaultQuery("count", "100"))
+	if err != nil || count <= 0 || count > maxUsersPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be an integer between 1 and 1000"})
+		return
+	}
+
+	users, next, err := s.storage.ListActiveUsers(c.Request.Context(), c.Query("cursor"), count)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_cursor": next})
+}
@@ -0,0 +1,25 @@
+package metrics
+
+// Ingest содержит метрики приема записей логов от нод.
+type Ingest struct {
+	Authenticated      *Counter
+	RejectedNoAuth     *Counter
+	RejectedBadToken   *Counter
+	RejectedStoreError *Counter
+	EntriesAccepted    *Counter
+	EntriesRejected    *Counter
+}
+
+// NewIngest регистрирует метрики приема в реестре.
+func NewIngest(r *Registry) *Ingest {
+	const rejected = "observer_ingest_requests_rejected_total"
+	const rejectedHelp = "Ingest requests rejected because the node could not be authenticated."
+	return &Ingest{
+		Authenticated:      r.Counter("observer_ingest_requests_authenticated_total", "Ingest requests authenticated by a node token or client certificate."),
+		RejectedNoAuth:     r.LabeledCounter(rejected, rejectedHelp, `reason="missing_credentials"`),
+		RejectedBadToken:   r.LabeledCounter(rejected, rejectedHelp, `reason="invalid_token"`),
+		RejectedStoreError: r.LabeledCounter(rejected, rejectedHelp, `reason="store_error"`),
+		EntriesAccepted:    r.Counter("observer_ingest_entries_accepted_total", "Log entries accepted for processing."),
+		EntriesRejected:    r.Counter("observer_ingest_entries_rejected_total", "Log entries rejected by validation."),
+	}
+}
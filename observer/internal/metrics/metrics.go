@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter — монотонно возрастающий счетчик.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc увеличивает счетчик на 1.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add увеличивает счетчик на n.
+func (c *Counter) Add(n int) {
+	if n > 0 {
+		c.value.Add(uint64(n))
+	}
+}
+
+// Value возвращает текущее значение счетчика.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Gauge — значение, которое может как расти, так и уменьшаться.
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Add изменяет значение на delta (delta может быть отрицательным).
+func (g *Gauge) Add(delta int64) {
+	g.value.Add(delta)
+}
+
+// Value возвращает текущее значение.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// Registry хранит именованные метрики и выводит их в текстовом формате Prometheus.
+type Registry struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+type entry struct {
+	name   string
+	help   string
+	labels string
+	metric interface{}
+}
+
+// NewRegistry создает пустой реестр метрик.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter регистрирует и возвращает новый счетчик.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, "", c)
+	return c
+}
+
+// LabeledCounter регистрирует счетчик с фиксированным набором меток, например `reason="invalid_token"`.
+func (r *Registry) LabeledCounter(name, help, labels string) *Counter {
+	c := &Counter{}
+	r.register(name, help, labels, c)
+	return c
+}
+
+// Gauge регистрирует и возвращает новый gauge.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, "", g)
+	return g
+}
+
+// LabeledGauge регистрирует gauge с фиксированным набором меток, например `shard="1"`.
+func (r *Registry) LabeledGauge(name, help, labels string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, labels, g)
+	return g
+}
+
+func (r *Registry) register(name, help, labels string, metric interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry{name: name, help: help, labels: labels, metric: metric})
+}
+
+// WriteTo выводит все метрики в текстовом формате Prometheus.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	entries := append([]entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	described := make(map[string]bool)
+	for _, e := range entries {
+		if !described[e.name] {
+			described[e.name] = true
+			fmt.Fprintf(&b, "# HELP %s %s\n", e.name, e.help)
+			fmt.Fprintf(&b, "# TYPE %s %s\n", e.name, metricType(e.metric))
+		}
+		switch m := e.metric.(type) {
+		case *Counter:
+			fmt.Fprintf(&b, "%s%s %d\n", e.name, wrapLabels(e.labels), m.Value())
+		case *Gauge:
+			fmt.Fprintf(&b, "%s%s %d\n", e.name, wrapLabels(e.labels), m.Value())
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func metricType(metric interface{}) string {
+	switch metric.(type) {
+	case *Counter:
+		return "counter"
+	default:
+		return "gauge"
+	}
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import "strconv"
+
+// Processor содержит метрики шардов обработки логов.
+type Processor struct {
+	ShardDepth     []*Gauge
+	ShardRejected  []*Counter
+	ShardProcessed []*Counter
+	CacheHits      *Counter
+	CacheMisses    *Counter
+	CacheEvictions *Counter
+	CacheEntries   *Gauge
+}
+
+// NewProcessor регистрирует метрики для shards шардов обработки.
+func NewProcessor(r *Registry, shards int) *Processor {
+	m := &Processor{
+		ShardDepth:     make([]*Gauge, shards),
+		ShardRejected:  make([]*Counter, shards),
+		ShardProcessed: make([]*Counter, shards),
+		CacheHits:      r.Counter("observer_hot_cache_hits_total", "Log entries answered from the in-process (user, IP) cache without a Redis check."),
+		CacheMisses:    r.Counter("observer_hot_cache_misses_total", "Log entries that required a Redis check."),
+		CacheEvictions: r.Counter("observer_hot_cache_evictions_total", "(user, IP) pairs evicted from the in-process cache because it was full."),
+		CacheEntries:   r.Gauge("observer_hot_cache_entries", "(user, IP) pairs currently held in the in-process cache."),
+	}
+	// Серии одной метрики регистрируются подряд: формат Prometheus требует, чтобы они шли вместе.
+	for i := range m.ShardDepth {
+		m.ShardDepth[i] = r.LabeledGauge("observer_shard_queue_depth", "Log entries waiting in the shard queue.", shardLabel(i))
+	}
+	for i := range m.ShardRejected {
+		m.ShardRejected[i] = r.LabeledCounter("observer_shard_rejected_entries_total", "Log entries rejected because the shard queue was full.", shardLabel(i))
+	}
+	for i := range m.ShardProcessed {
+		m.ShardProcessed[i] = r.LabeledCounter("observer_shard_processed_entries_total", "Log entries processed by the shard worker.", shardLabel(i))
+	}
+	return m
+}
+
+func shardLabel(shard int) string {
+	return `shard="` + strconv.Itoa(shard) + `"`
+}
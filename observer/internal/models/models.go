@@ -1,9 +1,18 @@
 package models
 
+import "time"
+
 // LogEntry представляет запись лога, поступающую в сервис.
 type LogEntry struct {
 	UserEmail string `json:"user_email" binding:"required"`
 	SourceIP  string `json:"source_ip" binding:"required"`
+	NodeID    string `json:"node_id,omitempty"` // Нода, с которой пришла запись (если известна)
+}
+
+// NodeCredential описывает действующий токен ноды для отправки логов (без самого токена).
+type NodeCredential struct {
+	NodeID    string    `json:"node_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // AlertPayload представляет данные для отправки в вебхук.
@@ -14,6 +23,31 @@ type AlertPayload struct {
 	AllUserIPs       []string `json:"all_user_ips"`
 	BlockDuration    string   `json:"block_duration"`
 	ViolationType    string   `json:"violation_type"`
+	BlockID          string   `json:"block_id,omitempty"`
+	BlockStatus      string   `json:"block_status,omitempty"`
+}
+
+// Типы отложенных задач.
+const (
+	JobClearIPs          = "clear_ips"           // Очистка IP пользователя после блокировки
+	JobBlockStatusReport = "block_status_report" // Алерт со сводкой применения блокировки на нодах
+	JobSendAlert         = "send_alert"          // Отправка вебхук-уведомления
+)
+
+// Job — отложенная задача, которая хранится в Redis и переживает перезапуск observer.
+type Job struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	UserEmail string        `json:"user_email,omitempty"`
+	BlockID   string        `json:"block_id,omitempty"`
+	Alert     *AlertPayload `json:"alert,omitempty"`
+	Attempts  int           `json:"attempts,omitempty"`
+}
+
+// ActiveUser — запись индекса активных пользователей.
+type ActiveUser struct {
+	Email    string    `json:"email"`
+	LastSeen time.Time `json:"last_seen"`
 }
 
 // UserIPStats содержит статистику по IP-адресам пользователя для мониторинга.
@@ -33,14 +67,74 @@ type UserIPStats struct {
 
 // BlockMessage представляет сообщение для отправки в очередь на блокировку.
 type BlockMessage struct {
+	BlockID  string   `json:"block_id"`
 	IPs      []string `json:"ips"`
 	Duration string   `json:"duration"`
 }
 
+// BlockResult представляет отчет блокировщика о применении команды на ноде.
+type BlockResult struct {
+	BlockID     string    `json:"block_id"`
+	NodeID      string    `json:"node_id"`
+	AppliedIPs  []string  `json:"applied_ips"`
+	FailedIPs   []string  `json:"failed_ips"`
+	RefusedIPs  []string  `json:"refused_ips,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// BlockStatus содержит агрегированное состояние блокировки по всем нодам.
+type BlockStatus struct {
+	BlockID        string                 `json:"block_id"`
+	UserIdentifier string                 `json:"user_identifier"`
+	IPs            []string               `json:"ips"`
+	Duration       string                 `json:"duration"`
+	PublishedAt    time.Time              `json:"published_at"`
+	AppliedNodes   int                    `json:"applied_nodes"`
+	PartialNodes   int                    `json:"partial_nodes"`
+	FailedNodes    int                    `json:"failed_nodes"`
+	ExpectedNodes  int                    `json:"expected_nodes"`
+	Summary        string                 `json:"summary"`
+	Nodes          map[string]BlockResult `json:"nodes"`
+}
+
+// CheckRequest — одна проверка IP пользователя в пакетном CheckAndAddIPs.
+type CheckRequest struct {
+	Email string
+	IP    string
+	Limit int
+}
+
 // CheckResult представляет результат выполнения Lua-скрипта.
 type CheckResult struct {
 	StatusCode     int64
 	CurrentIPCount int64
 	IsNewIP        bool
 	AllUserIPs     []string
-}
\ No newline at end of file
+	Err            error // Ошибка проверки этой записи в пакетном режиме
+}
+
+// ActiveBlock описывает IP-адрес, который должен оставаться заблокированным до ExpiresAt.
+type ActiveBlock struct {
+	IP        string    `json:"ip"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BlockSnapshot представляет полный список активных блокировок для синхронизации блокировщиков.
+type BlockSnapshot struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Blocks      []ActiveBlock `json:"blocks"`
+}
+
+// SnapshotRequest — запрос снимка блокировок через Redis: ответ ожидается в списке ReplyTo.
+type SnapshotRequest struct {
+	NodeID  string `json:"node_id"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// SnapshotReply — ответ на запрос снимка через Redis.
+// Body передается строкой без изменений, чтобы подпись в Headers оставалась проверяемой.
+type SnapshotReply struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
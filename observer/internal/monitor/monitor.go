@@ -14,6 +14,9 @@ import (
 	"time"
 )
 
+// monitorPageSize — размер страницы при обходе индекса активных пользователей.
+const monitorPageSize = 500
+
 // PoolMonitor выполняет периодический мониторинг пулов IP.
 type PoolMonitor struct {
 	storage storage.IPStorage
@@ -49,14 +52,21 @@ func (m *PoolMonitor) Run(ctx context.Context, wg *sync.WaitGroup) {
 }
 
 func (m *PoolMonitor) performMonitoring(ctx context.Context) {
-	userEmails, err := m.storage.GetAllUserEmails(ctx)
+	// Пользователи без активности дольше TTL IP уже не имеют IP — снимаем их с индекса.
+	if pruned, err := m.storage.PruneInactiveUsers(ctx, time.Now().Add(-m.cfg.UserIPTTL)); err != nil {
+		log.Printf("Ошибка мониторинга (PruneInactiveUsers): %v", err)
+	} else if pruned > 0 {
+		log.Printf("Из индекса активных пользователей удалено неактивных: %d", pruned)
+	}
+
+	allStats, err := m.collectStats(ctx)
 	if err != nil {
-		log.Printf("Ошибка мониторинга (GetAllUserEmails): %v", err)
+		log.Printf("Ошибка мониторинга (ListActiveUsers): %v", err)
 		return
 	}
 
 	now := time.Now().Format("2006-01-02 15:04:05")
-	if len(userEmails) == 0 {
+	if len(allStats) == 0 {
 		fmt.Printf("[%s] === IP POOLS MONITORING === НЕТ АКТИВНЫХ ПОЛЬЗОВАТЕЛЕЙ\n", now)
 		return
 	}
@@ -64,18 +74,6 @@ func (m *PoolMonitor) performMonitoring(ctx context.Context) {
 	fmt.Printf("\n[%s] === IP POOLS MONITORING START ===\n", now)
 	defer fmt.Printf("[%s] === IP POOLS MONITORING END ===\n\n", time.Now().Format("2006-01-02 15:04:05"))
 
-	var allStats []models.UserIPStats
-	for _, email := range userEmails {
-		stats, err := m.buildUserStats(ctx, email)
-		if err != nil {
-			log.Printf("Ошибка при сборе статистики для %s: %v", email, err)
-			continue
-		}
-		if stats != nil {
-			allStats = append(allStats, *stats)
-		}
-	}
-
 	sort.Slice(allStats, func(i, j int) bool {
 		return allStats[i].IPCount > allStats[j].IPCount
 	})
@@ -85,6 +83,40 @@ func (m *PoolMonitor) performMonitoring(ctx context.Context) {
 	m.printOverLimitUsers(allStats)
 }
 
+// collectStats обходит индекс активных пользователей постранично и собирает статистику
+// пользователей, у которых остались активные IP.
+func (m *PoolMonitor) collectStats(ctx context.Context) ([]models.UserIPStats, error) {
+	var allStats []models.UserIPStats
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		users, next, err := m.storage.ListActiveUsers(ctx, cursor, monitorPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			// При изменении индекса во время обхода пользователь может встретиться дважды.
+			if seen[user.Email] {
+				continue
+			}
+			seen[user.Email] = true
+
+			stats, err := m.buildUserStats(ctx, user.Email)
+			if err != nil {
+				log.Printf("Ошибка при сборе статистики для %s: %v", user.Email, err)
+				continue
+			}
+			if stats != nil {
+				allStats = append(allStats, *stats)
+			}
+		}
+		if next == "" {
+			return allStats, nil
+		}
+		cursor = next
+	}
+}
+
 func (m *PoolMonitor) buildUserStats(ctx context.Context, email string) (*models.UserIPStats, error) {
 	activeIPs, err := m.storage.GetUserActiveIPs(ctx, email)
 	if err != nil {
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"container/list"
+	"observer_service/internal/metrics"
+	"sync"
+	"time"
+)
+
+// hotCache помнит недавно подтвержденные в Redis пары (пользователь, IP). Повторная запись
+// той же пары в пределах refresh не требует обращения к Redis: IP заведомо уже есть
+// в множестве пользователя, а его TTL был обновлен не позже refresh назад.
+// Размер ограничен: при переполнении вытесняются давно не встречавшиеся пары.
+type hotCache struct {
+	mu      sync.Mutex
+	refresh time.Duration
+	max     int
+	order   *list.List                          // Пары от недавно встреченных к давним
+	items   map[string]map[string]*list.Element // Пользователь -> IP -> элемент order
+	size    int
+
+	entries   *metrics.Gauge
+	evictions *metrics.Counter
+}
+
+type hotEntry struct {
+	user        string
+	ip          string
+	confirmedAt time.Time
+}
+
+func newHotCache(max int, refresh time.Duration, entries *metrics.Gauge, evictions *metrics.Counter) *hotCache {
+	return &hotCache{
+		refresh:   refresh,
+		max:       max,
+		order:     list.New(),
+		items:     make(map[string]map[string]*list.Element),
+		entries:   entries,
+		evictions: evictions,
+	}
+}
+
+// Seen сообщает, была ли пара подтверждена в Redis не раньше refresh назад.
+func (c *hotCache) Seen(user, ip string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[user][ip]
+	if !ok {
+		return false
+	}
+	if now.Sub(el.Value.(*hotEntry).confirmedAt) >= c.refresh {
+		c.removeLocked(el)
+		return false
+	}
+	c.order.MoveToFront(el)
+	return true
+}
+
+// Add запоминает пару, только что подтвержденную в Redis.
+func (c *hotCache) Add(user, ip string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[user][ip]; ok {
+		el.Value.(*hotEntry).confirmedAt = now
+		c.order.MoveToFront(el)
+		return
+	}
+
+	userIPs, ok := c.items[user]
+	if !ok {
+		userIPs = make(map[string]*list.Element)
+		c.items[user] = userIPs
+	}
+	userIPs[ip] = c.order.PushFront(&hotEntry{user: user, ip: ip, confirmedAt: now})
+	c.size++
+	c.entries.Add(1)
+
+	for c.size > c.max {
+		c.removeLocked(c.order.Back())
+		c.evictions.Inc()
+	}
+}
+
+// InvalidateUser забывает все пары пользователя, например после очистки его IP в Redis.
+// Сброс действует только в этом процессе: кеши других экземпляров observer устаревают
+// не дольше чем на refresh, после чего пара снова проверяется в Redis.
+func (c *hotCache) InvalidateUser(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, el := range c.items[user] {
+		c.removeLocked(el)
+	}
+}
+
+func (c *hotCache) removeLocked(el *list.Element) {
+	entry := c.order.Remove(el).(*hotEntry)
+	userIPs := c.items[entry.user]
+	delete(userIPs, entry.ip)
+	if len(userIPs) == 0 {
+		delete(c.items, entry.user)
+	}
+	c.size--
+	c.entries.Add(-1)
+}
@@ -2,68 +2,156 @@ package processor
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
 	"observer_service/internal/config"
+	"observer_service/internal/metrics"
 	"observer_service/internal/models"
 	"observer_service/internal/services/alerter"
 	"observer_service/internal/services/publisher"
 	"observer_service/internal/services/storage"
+	"observer_service/internal/services/tracker"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// drainRetryInterval — как часто при остановке проверяется, освободился ли воркер для следующей задачи.
+const drainRetryInterval = 100 * time.Millisecond
+
+// ErrQueueFull означает, что часть записей не принята из-за переполнения очередей шардов.
+var ErrQueueFull = errors.New("log shard queue is full")
+
+// BackpressureError сообщает, сколько записей пачки принято, а сколько отклонено
+// из-за переполненных шардов. Записи остальных шардов при этом приняты.
+type BackpressureError struct {
+	Accepted   int
+	Rejected   int
+	FullShards []int
+}
+
+func (e *BackpressureError) Error() string {
+	return fmt.Sprintf("%v: rejected %d of %d entries (shards %v)", ErrQueueFull, e.Rejected, e.Accepted+e.Rejected, e.FullShards)
+}
+
+func (e *BackpressureError) Unwrap() error {
+	return ErrQueueFull
+}
+
 // LogProcessor обрабатывает входящие логи.
+// Записи распределяются по шардам по хешу пользователя: каждый шард обслуживает один воркер,
+// поэтому записи одного пользователя обрабатываются строго по очереди.
 type LogProcessor struct {
 	storage           storage.IPStorage
+	blocks            storage.BlockStore
+	jobs              storage.JobStore
 	publisher         publisher.EventPublisher
 	alerter           alerter.Notifier
+	tracker           *tracker.BlockTracker
 	cfg               *config.Config
-	logChannel        chan []models.LogEntry // Канал для получения пачек логов
-	sideEffectChannel chan func()            // Канал для побочных задач (алерты, очистка)
+	metrics           *metrics.Processor
+	shards            []chan []models.LogEntry // Очереди шардов с пачками логов
+	caches            []*hotCache              // Кеш подтвержденных пар (пользователь, IP) по шардам; nil — выключен
+	sideEffectChannel chan func()              // Канал для побочных задач (алерты, очистка)
+
+	stopLogs            chan struct{} // Закрывается DrainLogs: прием записей прекращен
+	logsDone            chan struct{} // Закрывается, когда воркеры шардов остановлены
+	stopSideEffects     chan struct{} // Закрывается DrainSideEffects: опрос задач прекращен
+	sideEffectsDone     chan struct{} // Закрывается, когда воркеры побочных задач остановлены
+	stopLogsOnce        sync.Once
+	stopSideEffectsOnce sync.Once
+	droppedEntries      atomic.Int64 // Принятые записи, не обработанные из-за остановки
+	skippedTasks        atomic.Int64 // Выданные воркерам задачи, не выполненные из-за остановки
+	activeJobs          atomic.Int64 // Взятые в аренду задачи, еще не завершенные воркерами
 }
 
-// NewLogProcessor создает новый экземпляр LogProcessor.
-func NewLogProcessor(s storage.IPStorage, p publisher.EventPublisher, a alerter.Notifier, cfg *config.Config) *LogProcessor {
+// NewLogProcessor создает новый экземпляр LogProcessor с WORKER_POOL_SIZE шардами,
+// в очереди каждого из которых помещается LOG_CHANNEL_BUFFER_SIZE пачек.
+func NewLogProcessor(s storage.IPStorage, b storage.BlockStore, j storage.JobStore, p publisher.EventPublisher, a alerter.Notifier, t *tracker.BlockTracker, cfg *config.Config, m *metrics.Processor) *LogProcessor {
+	shards := make([]chan []models.LogEntry, cfg.WorkerPoolSize)
+	for i := range shards {
+		shards[i] = make(chan []models.LogEntry, cfg.LogChannelBufferSize)
+	}
+
+	// У каждого шарда свой кеш: пользователь всегда обрабатывается одним шардом.
+	var caches []*hotCache
+	if cfg.HotCacheSize > 0 && cfg.HotCacheRefresh > 0 {
+		perShard := (cfg.HotCacheSize + len(shards) - 1) / len(shards)
+		caches = make([]*hotCache, len(shards))
+		for i := range caches {
+			caches[i] = newHotCache(perShard, cfg.HotCacheRefresh, m.CacheEntries, m.CacheEvictions)
+		}
+	}
+
 	return &LogProcessor{
 		storage:           s,
+		blocks:            b,
+		jobs:              j,
 		publisher:         p,
 		alerter:           a,
+		tracker:           t,
 		cfg:               cfg,
-		logChannel:        make(chan []models.LogEntry, cfg.LogChannelBufferSize),
+		metrics:           m,
+		shards:            shards,
+		caches:            caches,
 		sideEffectChannel: make(chan func(), cfg.SideEffectChannelBufferSize),
+		stopLogs:          make(chan struct{}),
+		logsDone:          make(chan struct{}),
+		stopSideEffects:   make(chan struct{}),
+		sideEffectsDone:   make(chan struct{}),
 	}
 }
 
-// StartWorkerPool запускает пул горутин-воркеров для обработки логов.
+// StartWorkerPool запускает по одному воркеру на каждый шард обработки логов.
+// Пул работает до вызова DrainLogs, после которого воркеры обрабатывают уже принятые
+// записи и останавливаются. Отмена ctx прерывает обработку: оставшиеся записи отбрасываются.
 func (p *LogProcessor) StartWorkerPool(ctx context.Context, mainWg *sync.WaitGroup) {
 	defer mainWg.Done()
+	defer close(p.logsDone)
 
 	var workerWg sync.WaitGroup
-	log.Printf("Запуск пула воркеров обработки логов в количестве %d...", p.cfg.WorkerPoolSize)
+	log.Printf("Запуск воркеров обработки логов: %d шардов...", len(p.shards))
 
-	for i := 0; i < p.cfg.WorkerPoolSize; i++ {
+	for i := range p.shards {
 		workerWg.Add(1)
-		go func(workerID int) {
+		go func(shard int) {
 			defer workerWg.Done()
-			log.Printf("Воркер обработки логов %d запущен", workerID)
-			for entries := range p.logChannel {
-				p.ProcessEntries(ctx, entries)
+			log.Printf("Воркер шарда %d запущен", shard)
+			for entries := range p.shards[shard] {
+				if ctx.Err() != nil {
+					p.droppedEntries.Add(int64(len(entries)))
+				} else {
+					p.ProcessEntries(ctx, entries)
+				}
+				p.metrics.ShardDepth[shard].Add(-int64(len(entries)))
+				p.metrics.ShardProcessed[shard].Add(len(entries))
 			}
-			log.Printf("Воркер обработки логов %d останавливается.", workerID)
-		}(i + 1)
+			log.Printf("Воркер шарда %d останавливается.", shard)
+		}(i)
 	}
 
-	<-ctx.Done()
-	log.Println("Получен сигнал остановки для воркеров обработки логов. Закрываю канал...")
-	close(p.logChannel)
+	select {
+	case <-p.stopLogs:
+	case <-ctx.Done():
+	}
+	log.Println("Получен сигнал остановки для воркеров обработки логов. Закрываю очереди шардов...")
+	for _, shard := range p.shards {
+		close(shard)
+	}
 	workerWg.Wait()
 	log.Println("Все воркеры обработки логов успешно остановлены.")
 }
 
-// StartSideEffectWorkerPool запускает пул воркеров для выполнения побочных задач.
+// StartSideEffectWorkerPool запускает пул воркеров для выполнения побочных задач
+// и опрос очереди отложенных задач, который раздает воркерам наступившие задачи.
+// Пул работает до вызова DrainSideEffects или отмены ctx.
 func (p *LogProcessor) StartSideEffectWorkerPool(ctx context.Context, mainWg *sync.WaitGroup) {
 	defer mainWg.Done()
+	defer close(p.sideEffectsDone)
 
 	var workerWg sync.WaitGroup
 	log.Printf("Запуск пула воркеров побочных задач в количестве %d...", p.cfg.SideEffectWorkerPoolSize)
@@ -77,7 +165,7 @@ func (p *LogProcessor) StartSideEffectWorkerPool(ctx context.Context, mainWg *sy
 				// Проверяем, не был ли контекст отменен перед выполнением задачи
 				select {
 				case <-ctx.Done():
-					log.Printf("Воркер побочных задач %d пропустил задачу из-за отмены контекста.", workerID)
+					p.skippedTasks.Add(1)
 				default:
 					task()
 				}
@@ -86,68 +174,189 @@ func (p *LogProcessor) StartSideEffectWorkerPool(ctx context.Context, mainWg *sy
 		}(i + 1)
 	}
 
-	<-ctx.Done()
+	pollerDone := make(chan struct{})
+	go func() {
+		defer close(pollerDone)
+		p.pollJobs(ctx)
+	}()
+
+	select {
+	case <-p.stopSideEffects:
+	case <-ctx.Done():
+	}
+	// Канал закрывается только после остановки опроса, который в него пишет.
+	<-pollerDone
 	log.Println("Получен сигнал остановки для воркеров побочных задач. Закрываю канал...")
 	close(p.sideEffectChannel)
 	workerWg.Wait()
 	log.Println("Все воркеры побочных задач успешно остановлены.")
 }
 
-// EnqueueEntries добавляет пачку логов в очередь на обработку.
-func (p *LogProcessor) EnqueueEntries(entries []models.LogEntry) error {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Println("Попытка записи в закрытый канал логов. Сервис находится в процессе остановки.")
-		}
-	}()
+// DrainLogs прекращает прием записей и ждет, пока воркеры шардов обработают уже принятые.
+// Возвращает false, если ctx истек раньше; тогда обработку прерывает отмена контекста пула.
+func (p *LogProcessor) DrainLogs(ctx context.Context) bool {
+	p.stopLogsOnce.Do(func() { close(p.stopLogs) })
+	select {
+	case <-p.logsDone:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
+// DrainSideEffects выдает воркерам все уже наступившие отложенные задачи, прекращает опрос
+// и ждет их выполнения. Возвращает false, если ctx истек раньше. Невыполненные задачи
+// остаются в Redis и будут выданы снова после окончания аренды; задачи, срок которых
+// еще не наступил, выполнятся после перезапуска.
+func (p *LogProcessor) DrainSideEffects(ctx context.Context) bool {
+	p.stopSideEffectsOnce.Do(func() { close(p.stopSideEffects) })
 	select {
-	case p.logChannel <- entries:
+	case <-p.sideEffectsDone:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Dropped возвращает число принятых записей логов и выданных воркерам задач,
+// которые не были обработаны из-за остановки сервиса.
+func (p *LogProcessor) Dropped() (entries, tasks int64) {
+	return p.droppedEntries.Load(), p.skippedTasks.Load()
+}
+
+// EnqueueEntries раскладывает пачку логов по шардам пользователей. Если очередь шарда заполнена,
+// отклоняются только записи этого шарда, а вызывающий получает *BackpressureError.
+func (p *LogProcessor) EnqueueEntries(entries []models.LogEntry) error {
+	if len(p.shards) == 1 {
+		if !p.enqueueShard(0, entries) {
+			return &BackpressureError{Rejected: len(entries), FullShards: []int{0}}
+		}
 		return nil
-	default:
-		return errors.New("log channel is full, rejecting new entries")
 	}
+
+	perShard := make([][]models.LogEntry, len(p.shards))
+	for _, entry := range entries {
+		shard := p.shardFor(entry.UserEmail)
+		perShard[shard] = append(perShard[shard], entry)
+	}
+
+	var bp BackpressureError
+	for shard, shardEntries := range perShard {
+		if len(shardEntries) == 0 {
+			continue
+		}
+		if p.enqueueShard(shard, shardEntries) {
+			bp.Accepted += len(shardEntries)
+			continue
+		}
+		bp.Rejected += len(shardEntries)
+		bp.FullShards = append(bp.FullShards, shard)
+	}
+	if bp.Rejected > 0 {
+		return &bp
+	}
+	return nil
 }
 
-// enqueueSideEffectTask добавляет побочную задачу в очередь на выполнение.
-func (p *LogProcessor) enqueueSideEffectTask(task func()) {
+// enqueueShard кладет пачку в очередь шарда без ожидания. Возвращает false, если очередь заполнена.
+func (p *LogProcessor) enqueueShard(shard int, entries []models.LogEntry) (ok bool) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("Попытка записи в закрытый канал побочных задач. Сервис находится в процессе остановки.")
+			log.Println("Попытка записи в закрытую очередь шарда. Сервис находится в процессе остановки.")
+			p.metrics.ShardDepth[shard].Add(-int64(len(entries)))
+			p.droppedEntries.Add(int64(len(entries)))
+			ok = true // Как и раньше, запись при остановке не считается перегрузкой
 		}
 	}()
 
+	// Глубина увеличивается до отправки, чтобы воркер не успел уменьшить ее раньше.
+	p.metrics.ShardDepth[shard].Add(int64(len(entries)))
 	select {
-	case p.sideEffectChannel <- task:
-		// Задача успешно добавлена в очередь
+	case p.shards[shard] <- entries:
+		return true
 	default:
-		log.Println("Warning: очередь побочных задач заполнена. Задача отброшена.")
+		p.metrics.ShardDepth[shard].Add(-int64(len(entries)))
+		p.metrics.ShardRejected[shard].Add(len(entries))
+		return false
 	}
 }
 
-// ProcessEntries обрабатывает пачку записей логов.
+// shardFor возвращает шард пользователя. Все записи одного пользователя попадают в один шард.
+func (p *LogProcessor) shardFor(userEmail string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userEmail))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// ProcessEntries обрабатывает пачку записей логов. Проверки всех записей пачки выполняются
+// в Redis одним конвейером, после чего результаты разбираются в исходном порядке.
 func (p *LogProcessor) ProcessEntries(ctx context.Context, entries []models.LogEntry) {
+	if ctx.Err() != nil {
+		log.Printf("Обработка пачки прервана из-за отмены контекста: %v", ctx.Err())
+		p.droppedEntries.Add(int64(len(entries)))
+		return
+	}
+
+	now := time.Now()
+	checked := make([]models.LogEntry, 0, len(entries))
+	requests := make([]models.CheckRequest, 0, len(entries))
 	for _, entry := range entries {
-		select {
-		case <-ctx.Done():
+		if p.cfg.ExcludedUsers[entry.UserEmail] {
+			continue // Пользователь в списке исключений
+		}
+		// Недавно подтвержденный IP пользователя заведомо уже учтен в Redis.
+		if cache := p.cacheFor(entry.UserEmail); cache != nil {
+			if cache.Seen(entry.UserEmail, entry.SourceIP, now) {
+				p.metrics.CacheHits.Inc()
+				continue
+			}
+			p.metrics.CacheMisses.Inc()
+		}
+		checked = append(checked, entry)
+		requests = append(requests, models.CheckRequest{
+			Email: entry.UserEmail,
+			IP:    entry.SourceIP,
+			Limit: p.getUserIPLimit(entry.UserEmail),
+		})
+	}
+	if len(requests) == 0 {
+		return
+	}
+
+	results := p.storage.CheckAndAddIPs(ctx, requests, p.cfg.UserIPTTL, p.cfg.AlertCooldown)
+	for i, entry := range checked {
+		if ctx.Err() != nil {
 			log.Printf("Обработка пачки прервана из-за отмены контекста: %v", ctx.Err())
+			p.droppedEntries.Add(int64(len(checked) - i))
 			return
-		default:
-			p.processSingleEntry(ctx, entry)
 		}
+		res := &results[i]
+		if cache := p.cacheFor(entry.UserEmail); cache != nil && res.Err == nil {
+			switch res.StatusCode {
+			case 0:
+				cache.Add(entry.UserEmail, entry.SourceIP, now)
+			case 1:
+				cache.InvalidateUser(entry.UserEmail) // IP пользователя скоро будут очищены
+			}
+		}
+		p.handleCheckResult(ctx, entry, requests[i].Limit, res)
 	}
 }
 
-func (p *LogProcessor) processSingleEntry(ctx context.Context, entry models.LogEntry) {
-	if p.cfg.ExcludedUsers[entry.UserEmail] {
-		return // Пользователь в списке исключений
+// cacheFor возвращает кеш шарда пользователя или nil, если кеш выключен.
+func (p *LogProcessor) cacheFor(userEmail string) *hotCache {
+	if p.caches == nil {
+		return nil
 	}
+	return p.caches[p.shardFor(userEmail)]
+}
 
-	userIPLimit := p.getUserIPLimit(entry.UserEmail)
+// handleCheckResult реагирует на результат проверки одной записи: логирует новые IP,
+// а при превышении лимита публикует блокировку и планирует алерт и очистку IP.
+func (p *LogProcessor) handleCheckResult(ctx context.Context, entry models.LogEntry, userIPLimit int, res *models.CheckResult) {
 	debugMarker := p.getDebugMarker(entry.UserEmail)
 
-	res, err := p.storage.CheckAndAddIP(ctx, entry.UserEmail, entry.SourceIP, userIPLimit, p.cfg.UserIPTTL, p.cfg.AlertCooldown)
-	if err != nil {
+	if err := res.Err; err != nil {
 		// Проверяем, не была ли ошибка вызвана отменой контекста
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			log.Printf("Операция CheckAndAddIP отменена для %s: %v", entry.UserEmail, err)
@@ -158,8 +367,8 @@ func (p *LogProcessor) processSingleEntry(ctx context.Context, entry models.LogE
 	}
 
 	if res.StatusCode == 0 && res.IsNewIP {
-		log.Printf("Новый IP для пользователя %s%s: %s. Всего IP: %d/%d",
-			entry.UserEmail, debugMarker, entry.SourceIP, res.CurrentIPCount, userIPLimit)
+		log.Printf("Новый IP для пользователя %s%s: %s%s. Всего IP: %d/%d",
+			entry.UserEmail, debugMarker, entry.SourceIP, nodeMarker(entry.NodeID), res.CurrentIPCount, userIPLimit)
 	}
 
 	if res.StatusCode == 1 { // Лимит превышен, нужна блокировка
@@ -168,14 +377,33 @@ func (p *LogProcessor) processSingleEntry(ctx context.Context, entry models.LogE
 
 		ipsToBlock := p.filterExcludedIPs(res.AllUserIPs, entry.UserEmail)
 
+		var blockID string
 		if len(ipsToBlock) > 0 {
-			if err := p.publisher.PublishBlockMessage(ipsToBlock, p.cfg.BlockDuration); err != nil {
+			blockMsg := models.BlockMessage{
+				BlockID:  newBlockID(),
+				IPs:      ipsToBlock,
+				Duration: p.cfg.BlockDuration,
+			}
+			// Регистрируем блокировку до публикации, чтобы не потерять быстрые отчеты нод.
+			if err := p.tracker.Register(ctx, blockMsg, entry.UserEmail); err != nil {
+				log.Printf("Ошибка регистрации блокировки %s для отслеживания отчетов нод: %v", blockMsg.BlockID, err)
+			}
+
+			if err := p.publisher.PublishBlockMessage(blockMsg); err != nil {
+				if err := p.tracker.Remove(ctx, blockMsg.BlockID); err != nil {
+					log.Printf("Ошибка удаления неопубликованной блокировки %s: %v", blockMsg.BlockID, err)
+				}
 				log.Printf("Ошибка отправки сообщения о блокировке: %v", err)
 			} else {
-				log.Printf("Сообщение о блокировке %d IP-адресов для %s%s отправлено", len(ipsToBlock), entry.UserEmail, debugMarker)
-				p.enqueueSideEffectTask(func() {
-					p.scheduleIPsClear(ctx, entry.UserEmail)
-				})
+				blockID = blockMsg.BlockID
+				log.Printf("Сообщение о блокировке %s (%d IP-адресов) для %s%s поставлено в очередь отправки", blockID, len(ipsToBlock), entry.UserEmail, debugMarker)
+				if err := p.blocks.AddActiveBlocks(ctx, ipsToBlock, p.cfg.BlockDurationTTL); err != nil {
+					log.Printf("Ошибка сохранения активной блокировки %s: %v", blockID, err)
+				}
+				p.scheduleJob(ctx, models.Job{Type: models.JobClearIPs, UserEmail: entry.UserEmail}, p.cfg.ClearIPsDelay)
+				if p.cfg.BlockStatusReportDelay > 0 {
+					p.scheduleJob(ctx, models.Job{Type: models.JobBlockStatusReport, UserEmail: entry.UserEmail, BlockID: blockID}, p.cfg.BlockStatusReportDelay)
+				}
 			}
 		}
 
@@ -186,12 +414,9 @@ func (p *LogProcessor) processSingleEntry(ctx context.Context, entry models.LogE
 			AllUserIPs:       res.AllUserIPs,
 			BlockDuration:    p.cfg.BlockDuration,
 			ViolationType:    "ip_limit_exceeded",
+			BlockID:          blockID,
 		}
-		p.enqueueSideEffectTask(func() {
-			if err := p.alerter.SendAlert(alertPayload); err != nil {
-				log.Printf("Ошибка отправки вебхук-уведомления: %v", err)
-			}
-		})
+		p.scheduleJob(ctx, models.Job{Type: models.JobSendAlert, UserEmail: entry.UserEmail, Alert: &alertPayload}, 0)
 	}
 }
 
@@ -209,6 +434,14 @@ func (p *LogProcessor) getDebugMarker(userEmail string) string {
 	return ""
 }
 
+// nodeMarker возвращает пометку о ноде, с которой пришла запись, для логов.
+func nodeMarker(nodeID string) string {
+	if nodeID == "" {
+		return ""
+	}
+	return " (нода " + nodeID + ")"
+}
+
 func (p *LogProcessor) filterExcludedIPs(ips []string, email string) []string {
 	var filtered []string
 	for _, ip := range ips {
@@ -221,30 +454,182 @@ func (p *LogProcessor) filterExcludedIPs(ips []string, email string) []string {
 	return filtered
 }
 
-func (p *LogProcessor) scheduleIPsClear(ctx context.Context, userEmail string) {
-	log.Printf("Планирование отложенной очистки IP для %s через %v.", userEmail, p.cfg.ClearIPsDelay)
+// scheduleJob сохраняет отложенную задачу, которая выполнится не раньше чем через delay.
+func (p *LogProcessor) scheduleJob(ctx context.Context, job models.Job, delay time.Duration) {
+	job.ID = newBlockID()
+	if err := p.jobs.ScheduleJob(ctx, job, time.Now().Add(delay)); err != nil {
+		log.Printf("Ошибка планирования задачи %s для %s: %v", job.Type, job.UserEmail, err)
+		return
+	}
+	if delay > 0 {
+		log.Printf("Задача %s для %s запланирована через %v.", job.Type, job.UserEmail, delay)
+	}
+}
 
-	time.AfterFunc(p.cfg.ClearIPsDelay, func() {
-		if ctx.Err() != nil {
-			log.Printf("Отложенная очистка IP для %s отменена из-за остановки сервиса.", userEmail)
-			return
+// pollJobs каждые JOB_POLL_INTERVAL_SECONDS забирает наступившие задачи и передает их воркерам.
+// Задачи берутся в аренду, поэтому одну задачу выполняет только один экземпляр observer.
+// Забирается не больше задач, чем свободных воркеров: иначе задача могла бы ждать в канале
+// дольше аренды и быть выданной другому экземпляру, пока этот еще не приступил к ней.
+// После вызова DrainSideEffects наступившие задачи забираются без паузы, пока они не кончатся;
+// отмена ctx прекращает опрос сразу.
+func (p *LogProcessor) pollJobs(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.JobPollInterval)
+	defer ticker.Stop()
+
+	draining := false
+	for {
+		if !draining {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.stopSideEffects:
+				draining = true
+			case <-ticker.C:
+			}
 		}
 
-		opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
+		idle := p.cfg.SideEffectWorkerPoolSize - int(p.activeJobs.Load())
+		if idle <= 0 {
+			if draining {
+				// Ждем, пока освободится воркер, не дожидаясь следующего тика.
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(drainRetryInterval):
+				}
+			}
+			continue
+		}
 
-		cleared, err := p.storage.ClearUserIPs(opCtx, userEmail)
+		jobs, err := p.jobs.ClaimDueJobs(ctx, idle, p.cfg.JobLease)
 		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				log.Printf("Отложенная очистка IP для %s отменена из-за остановки сервиса во время выполнения.", userEmail)
-			} else if errors.Is(err, context.DeadlineExceeded) {
-				log.Printf("Таймаут при отложенной очистке IP для %s.", userEmail)
-			} else {
-				log.Printf("Ошибка при отложенной очистке IP для %s: %v", userEmail, err)
+			if ctx.Err() == nil {
+				log.Printf("Ошибка опроса очереди отложенных задач: %v", err)
+			}
+			if draining {
+				return
 			}
+			continue
+		}
+		if draining && len(jobs) == 0 {
 			return
 		}
-		log.Printf("Отложенная очистка IP для %s%s выполнена. Очищено ключей: %d",
-			userEmail, p.getDebugMarker(userEmail), cleared)
+		for _, job := range jobs {
+			p.activeJobs.Add(1)
+			task := func() {
+				defer p.activeJobs.Add(-1)
+				p.runJob(ctx, job)
+			}
+			select {
+			case p.sideEffectChannel <- task:
+			case <-ctx.Done():
+				// Невыполненные задачи останутся в Redis и будут выданы снова после аренды.
+				return
+			}
+		}
+	}
+}
+
+// runJob выполняет задачу и удаляет ее из очереди. При ошибке задача переносится
+// с нарастающей задержкой, а после JOB_MAX_ATTEMPTS попыток отбрасывается.
+func (p *LogProcessor) runJob(ctx context.Context, job models.Job) {
+	opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := p.executeJob(opCtx, job)
+	if ctx.Err() != nil {
+		log.Printf("Задача %s для %s прервана остановкой сервиса и будет выполнена повторно.", job.Type, job.UserEmail)
+		return
+	}
+	if err == nil {
+		if err := p.jobs.CompleteJob(ctx, job.ID); err != nil {
+			log.Printf("Ошибка завершения задачи %s для %s: %v", job.Type, job.UserEmail, err)
+		}
+		return
+	}
+
+	job.Attempts++
+	if job.Attempts >= p.cfg.JobMaxAttempts {
+		log.Printf("Задача %s для %s отброшена после %d попыток: %v", job.Type, job.UserEmail, job.Attempts, err)
+		if err := p.jobs.CompleteJob(ctx, job.ID); err != nil {
+			log.Printf("Ошибка удаления задачи %s для %s: %v", job.Type, job.UserEmail, err)
+		}
+		return
+	}
+	retryIn := p.cfg.JobPollInterval << job.Attempts
+	log.Printf("Ошибка выполнения задачи %s для %s (попытка %d/%d), повтор через %v: %v",
+		job.Type, job.UserEmail, job.Attempts, p.cfg.JobMaxAttempts, retryIn, err)
+	if err := p.jobs.ScheduleJob(ctx, job, time.Now().Add(retryIn)); err != nil {
+		log.Printf("Ошибка переноса задачи %s для %s: %v", job.Type, job.UserEmail, err)
+	}
+}
+
+// executeJob выполняет действие задачи.
+func (p *LogProcessor) executeJob(ctx context.Context, job models.Job) error {
+	switch job.Type {
+	case models.JobClearIPs:
+		return p.clearUserIPs(ctx, job.UserEmail)
+	case models.JobBlockStatusReport:
+		return p.sendBlockStatusReport(ctx, job.UserEmail, job.BlockID)
+	case models.JobSendAlert:
+		if job.Alert == nil {
+			return nil
+		}
+		return p.alerter.SendAlert(*job.Alert)
+	default:
+		log.Printf("Неизвестный тип отложенной задачи '%s' пропущен.", job.Type)
+		return nil
+	}
+}
+
+// clearUserIPs очищает IP пользователя после блокировки. Повторная очистка безопасна.
+func (p *LogProcessor) clearUserIPs(ctx context.Context, userEmail string) error {
+	cleared, err := p.storage.ClearUserIPs(ctx, userEmail)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("таймаут очистки IP: %w", err)
+		}
+		return err
+	}
+	if cache := p.cacheFor(userEmail); cache != nil {
+		cache.InvalidateUser(userEmail)
+	}
+	log.Printf("Отложенная очистка IP для %s%s выполнена. Очищено ключей: %d",
+		userEmail, p.getDebugMarker(userEmail), cleared)
+	return nil
+}
+
+// sendBlockStatusReport отправляет алерт со сводкой применения блокировки на нодах
+// после того, как блокировщики успели прислать свои отчеты.
+// Состояние блокировки хранится в Redis, поэтому сводку может отправить любой экземпляр observer.
+// Ошибка чтения состояния возвращается, и задача повторяется.
+func (p *LogProcessor) sendBlockStatusReport(ctx context.Context, userEmail, blockID string) error {
+	status, ok, err := p.tracker.Get(ctx, blockID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения состояния блокировки %s: %w", blockID, err)
+	}
+	if !ok {
+		// Состояние истекло или не было сохранено (Redis был недоступен при публикации) — сводки нет.
+		log.Printf("Состояние блокировки %s для %s не найдено, сводка не отправлена.", blockID, userEmail)
+		return nil
+	}
+	log.Printf("Статус блокировки %s для %s%s: %s", blockID, userEmail, p.getDebugMarker(userEmail), status.Summary)
+
+	return p.alerter.SendAlert(models.AlertPayload{
+		UserIdentifier: userEmail,
+		AllUserIPs:     status.IPs,
+		BlockDuration:  status.Duration,
+		ViolationType:  "block_status",
+		BlockID:        blockID,
+		BlockStatus:    status.Summary,
 	})
-}
\ No newline at end of file
+}
+
+// newBlockID генерирует уникальный идентификатор команды блокировки.
+func newBlockID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(buf)
+}
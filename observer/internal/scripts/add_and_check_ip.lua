@@ -1,5 +1,7 @@
--- KEYS[1]: ключ множества IP пользователя (например, user_ips:email@example.com)
--- KEYS[2]: ключ кулдауна алертов для пользователя (например, alert_sent:email@example.com)
+-- KEYS[1]: ключ множества IP пользователя (например, user_ips:{email@example.com})
+-- KEYS[2]: ключ кулдауна алертов для пользователя (например, alert_sent:{email@example.com})
+-- KEYS[3]: ключ TTL добавляемого IP (например, ip_ttl:{email@example.com}:1.2.3.4)
+-- Все ключи пользователя содержат хеш-тег {email} и в Redis Cluster попадают в один слот.
 -- ARGV[1]: IP-адрес для добавления
 -- ARGV[2]: TTL для IP-адреса в секундах
 -- ARGV[3]: Лимит IP-адресов для пользователя
@@ -9,9 +11,7 @@
 local isNewIp = redis.call('SADD', KEYS[1], ARGV[1])
 
 -- Устанавливаем/обновляем TTL для конкретного IP-адреса.
--- Ключ для TTL формируется из ключа множества и самого IP.
-local ipTtlKey = 'ip_ttl:' .. string.sub(KEYS[1], 10) .. ':' .. ARGV[1]
-redis.call('SETEX', ipTtlKey, ARGV[2], '1')
+redis.call('SETEX', KEYS[3], ARGV[2], '1')
 
 -- Обновляем TTL для самого множества IP-адресов пользователя.
 -- Это гарантирует, что множество будет автоматически удалено, если пользователь неактивен.
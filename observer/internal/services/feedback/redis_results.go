@@ -0,0 +1,121 @@
+package feedback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"observer_service/internal/services/storage"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const streamBodyField = "body"
+
+// RedisResultConsumer получает отчеты блокировщиков из Redis Stream через группу потребителей.
+type RedisResultConsumer struct {
+	redisMode      string
+	redisURL       string
+	stream         string
+	group          string
+	consumer       string
+	recorder       ResultRecorder
+	reconnectDelay time.Duration
+}
+
+// NewRedisResultConsumer создает потребителя отчетов; group — имя группы потребителей observer.
+func NewRedisResultConsumer(redisMode, redisURL, stream, group string, recorder ResultRecorder) *RedisResultConsumer {
+	consumer, err := os.Hostname()
+	if err != nil || consumer == "" {
+		consumer = "observer"
+	}
+	return &RedisResultConsumer{
+		redisMode:      redisMode,
+		redisURL:       redisURL,
+		stream:         stream,
+		group:          group,
+		consumer:       consumer,
+		recorder:       recorder,
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+// Run потребляет отчеты до отмены контекста, переподключаясь при ошибках.
+func (c *RedisResultConsumer) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("Запуск потребителя отчетов блокировщиков (поток %s)...", c.stream)
+	for {
+		if err := c.consume(ctx); err != nil {
+			log.Printf("Потребитель отчетов блокировщиков остановлен с ошибкой: %v. Повтор через %v...", err, c.reconnectDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Остановка потребителя отчетов блокировщиков.")
+			return
+		case <-time.After(c.reconnectDelay):
+		}
+	}
+}
+
+// consume сначала дочитывает собственные неподтвержденные записи, затем ждет новые.
+func (c *RedisResultConsumer) consume(ctx context.Context) error {
+	client, err := storage.NewRedisClient(c.redisMode, c.redisURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = client.XGroupCreateMkStream(ctx, c.stream, c.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("ошибка создания группы потребителей отчетов: %w", err)
+	}
+
+	start := "0"
+	for ctx.Err() == nil {
+		streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.consumer,
+			Streams:  []string{c.stream, start},
+			Count:    100,
+			Block:    5 * time.Second,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ошибка чтения потока отчетов: %w", err)
+		}
+
+		read := 0
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				read++
+				body, _ := msg.Values[streamBodyField].(string)
+				if err := recordResult(ctx, c.recorder, []byte(body)); err != nil {
+					if !errors.Is(err, errMalformedResult) {
+						// Запись остается неподтвержденной и будет перечитана после переподключения.
+						return err
+					}
+					log.Printf("Отчет блокировщика отброшен: %v", err)
+				}
+				if err := client.XAck(ctx, c.stream, c.group, msg.ID).Err(); err != nil {
+					return fmt.Errorf("ошибка подтверждения отчета: %w", err)
+				}
+			}
+		}
+		// Собственный pending-список дочитан — переходим к новым записям.
+		if start == "0" && read == 0 {
+			start = ">"
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"observer_service/internal/services/signing"
+	"observer_service/internal/services/storage"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// snapshotReplyTTL ограничивает жизнь ответа, который блокировщик не успел забрать.
+const snapshotReplyTTL = 60 * time.Second
+
+// RedisSnapshotServer отвечает блокировщикам на запросы снимка, поступающие в список Redis.
+type RedisSnapshotServer struct {
+	redisMode      string
+	redisURL       string
+	requestsKey    string
+	blocks         storage.BlockStore
+	signer         *signing.Signer
+	reconnectDelay time.Duration
+}
+
+// NewRedisSnapshotServer создает обработчик запросов снимка через Redis.
+// Если задан signer, ответы подписываются так же, как команды блокировки.
+func NewRedisSnapshotServer(redisMode, redisURL, requestsKey string, blocks storage.BlockStore, signer *signing.Signer) *RedisSnapshotServer {
+	return &RedisSnapshotServer{
+		redisMode:      redisMode,
+		redisURL:       redisURL,
+		requestsKey:    requestsKey,
+		blocks:         blocks,
+		signer:         signer,
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+// Run обслуживает запросы снимка до отмены контекста, переподключаясь при ошибках.
+func (s *RedisSnapshotServer) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("Запуск обработчика запросов снимка блокировок (список %s)...", s.requestsKey)
+	for {
+		if err := s.serve(ctx); err != nil {
+			log.Printf("Обработчик запросов снимка остановлен с ошибкой: %v. Повтор через %v...", err, s.reconnectDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Остановка обработчика запросов снимка блокировок.")
+			return
+		case <-time.After(s.reconnectDelay):
+		}
+	}
+}
+
+func (s *RedisSnapshotServer) serve(ctx context.Context) error {
+	client, err := storage.NewRedisClient(s.redisMode, s.redisURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for ctx.Err() == nil {
+		res, err := client.BLPop(ctx, 5*time.Second, s.requestsKey).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ошибка чтения запросов снимка: %w", err)
+		}
+		s.reply(ctx, client, res[1])
+	}
+	return nil
+}
+
+func (s *RedisSnapshotServer) reply(ctx context.Context, client redis.UniversalClient, raw string) {
+	var request models.SnapshotRequest
+	// Ответ пишется только в ключи ответов, чтобы запрос не мог перезаписать произвольные данные в Redis.
+	if err := json.Unmarshal([]byte(raw), &request); err != nil || !strings.HasPrefix(request.ReplyTo, s.requestsKey+":reply:") {
+		log.Println("Некорректный запрос снимка отброшен.")
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	body, headers, err := buildSnapshot(opCtx, s.blocks, s.signer)
+	if err != nil {
+		log.Printf("Ошибка подготовки снимка блокировок: %v", err)
+		return
+	}
+
+	reply := models.SnapshotReply{Body: string(body), Headers: make(map[string]string, len(headers))}
+	for k, v := range headers {
+		reply.Headers[k] = fmt.Sprint(v)
+	}
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("Ошибка сериализации ответа со снимком: %v", err)
+		return
+	}
+
+	_, err = client.TxPipelined(opCtx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(opCtx, request.ReplyTo, payload)
+		pipe.Expire(opCtx, request.ReplyTo, snapshotReplyTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Ошибка отправки снимка блокировок: %v", err)
+		return
+	}
+	log.Printf("Снимок блокировок отправлен по запросу %s.", request.NodeID)
+}
@@ -0,0 +1,128 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// ResultRecorder принимает отчеты блокировщиков о применении команд.
+type ResultRecorder interface {
+	Record(ctx context.Context, result models.BlockResult) error
+}
+
+// errMalformedResult означает, что отчет не удалось разобрать и повторять его бессмысленно.
+var errMalformedResult = errors.New("некорректный отчет блокировщика")
+
+// RabbitMQResultConsumer получает отчеты блокировщиков из exchange результатов.
+type RabbitMQResultConsumer struct {
+	url            string
+	exchangeName   string
+	queueName      string
+	recorder       ResultRecorder
+	reconnectDelay time.Duration
+}
+
+// NewRabbitMQResultConsumer создает нового потребителя отчетов блокировщиков.
+func NewRabbitMQResultConsumer(url, exchangeName, queueName string, recorder ResultRecorder) *RabbitMQResultConsumer {
+	return &RabbitMQResultConsumer{
+		url:            url,
+		exchangeName:   exchangeName,
+		queueName:      queueName,
+		recorder:       recorder,
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+// Run потребляет отчеты до отмены контекста, переподключаясь при потере соединения.
+func (c *RabbitMQResultConsumer) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("Запуск потребителя отчетов блокировщиков (очередь %s)...", c.queueName)
+	for {
+		if err := c.consume(ctx); err != nil {
+			log.Printf("Потребитель отчетов блокировщиков остановлен с ошибкой: %v. Повтор через %v...", err, c.reconnectDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Остановка потребителя отчетов блокировщиков.")
+			return
+		case <-time.After(c.reconnectDelay):
+		}
+	}
+}
+
+func (c *RabbitMQResultConsumer) consume(ctx context.Context) error {
+	conn, err := amqp091.Dial(c.url)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("ошибка создания канала RabbitMQ: %w", err)
+	}
+	defer ch.Close()
+
+	if err := ch.ExchangeDeclare(c.exchangeName, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("ошибка создания exchange результатов: %w", err)
+	}
+	q, err := ch.QueueDeclare(c.queueName, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания очереди результатов: %w", err)
+	}
+	if err := ch.QueueBind(q.Name, "", c.exchangeName, false, nil); err != nil {
+		return fmt.Errorf("ошибка привязки очереди результатов: %w", err)
+	}
+	msgs, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации потребителя результатов: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("канал сообщений RabbitMQ был закрыт")
+			}
+			if err := recordResult(ctx, c.recorder, msg.Body); err != nil {
+				if errors.Is(err, errMalformedResult) {
+					log.Printf("Отчет блокировщика отброшен: %v", err)
+					_ = msg.Nack(false, false)
+					continue
+				}
+				// Отчет не сохранен: возвращаем его в очередь и переподключаемся с паузой.
+				_ = msg.Nack(false, true)
+				return err
+			}
+			_ = msg.Ack(false)
+		}
+	}
+}
+
+// recordResult декодирует отчет блокировщика и передает его recorder'у.
+// Ошибка разбора оборачивается в errMalformedResult; остальные ошибки временные.
+func recordResult(ctx context.Context, recorder ResultRecorder, body []byte) error {
+	var result models.BlockResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedResult, err)
+	}
+	if err := recorder.Record(ctx, result); err != nil {
+		return fmt.Errorf("ошибка сохранения отчета ноды %s: %w", result.NodeID, err)
+	}
+	if result.Error != "" {
+		log.Printf("Нода %s сообщила об ошибках блокировки %s: %s", result.NodeID, result.BlockID, result.Error)
+	}
+	return nil
+}
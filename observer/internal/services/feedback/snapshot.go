@@ -0,0 +1,142 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"observer_service/internal/services/signing"
+	"observer_service/internal/services/storage"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQSnapshotServer отвечает блокировщикам на запросы снимка активных блокировок.
+// Блокировщик запрашивает снимок при каждом (пере)подключении, чтобы применить
+// блокировки, пропущенные за время простоя.
+type RabbitMQSnapshotServer struct {
+	url            string
+	queueName      string
+	blocks         storage.BlockStore
+	signer         *signing.Signer
+	reconnectDelay time.Duration
+}
+
+// NewRabbitMQSnapshotServer создает новый обработчик запросов снимка.
+// Если задан signer, ответы подписываются так же, как команды блокировки.
+func NewRabbitMQSnapshotServer(url, queueName string, blocks storage.BlockStore, signer *signing.Signer) *RabbitMQSnapshotServer {
+	return &RabbitMQSnapshotServer{
+		url:            url,
+		queueName:      queueName,
+		blocks:         blocks,
+		signer:         signer,
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+// Run обслуживает запросы снимка до отмены контекста, переподключаясь при потере соединения.
+func (s *RabbitMQSnapshotServer) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("Запуск обработчика запросов снимка блокировок (очередь %s)...", s.queueName)
+	for {
+		if err := s.serve(ctx); err != nil {
+			log.Printf("Обработчик запросов снимка остановлен с ошибкой: %v. Повтор через %v...", err, s.reconnectDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Остановка обработчика запросов снимка блокировок.")
+			return
+		case <-time.After(s.reconnectDelay):
+		}
+	}
+}
+
+func (s *RabbitMQSnapshotServer) serve(ctx context.Context) error {
+	conn, err := amqp091.Dial(s.url)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("ошибка создания канала RabbitMQ: %w", err)
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclare(s.queueName, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания очереди запросов снимка: %w", err)
+	}
+	msgs, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации потребителя запросов снимка: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("канал сообщений RabbitMQ был закрыт")
+			}
+			s.reply(ctx, ch, msg)
+		}
+	}
+}
+
+func (s *RabbitMQSnapshotServer) reply(ctx context.Context, ch *amqp091.Channel, msg amqp091.Delivery) {
+	defer func() { _ = msg.Ack(false) }()
+
+	if msg.ReplyTo == "" {
+		log.Println("Запрос снимка без reply_to отброшен.")
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	body, headers, err := buildSnapshot(opCtx, s.blocks, s.signer)
+	if err != nil {
+		log.Printf("Ошибка подготовки снимка блокировок: %v", err)
+		return
+	}
+
+	err = ch.PublishWithContext(opCtx, "", msg.ReplyTo, false, false, amqp091.Publishing{
+		Headers:       headers,
+		ContentType:   "application/json",
+		CorrelationId: msg.CorrelationId,
+		Body:          body,
+	})
+	if err != nil {
+		log.Printf("Ошибка отправки снимка блокировок: %v", err)
+		return
+	}
+	log.Printf("Снимок блокировок отправлен по запросу %s.", msg.AppId)
+}
+
+// buildSnapshot собирает снимок активных блокировок и, если задан signer, его подпись.
+func buildSnapshot(ctx context.Context, blocks storage.BlockStore, signer *signing.Signer) ([]byte, map[string]interface{}, error) {
+	active, err := blocks.GetActiveBlocks(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения активных блокировок: %w", err)
+	}
+	body, err := json.Marshal(models.BlockSnapshot{
+		GeneratedAt: time.Now(),
+		Blocks:      active,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка сериализации снимка: %w", err)
+	}
+	headers, err := signer.Headers(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка подписи снимка: %w", err)
+	}
+	return body, headers, nil
+}
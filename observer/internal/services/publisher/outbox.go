@@ -0,0 +1,155 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"observer_service/internal/services/storage"
+	"sync"
+	"time"
+)
+
+const (
+	outboxClaimWait  = time.Second
+	outboxOpTimeout  = 5 * time.Second
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = 30 * time.Second
+	// outboxLease — аренда взятого сообщения. Она продлевается перед каждой попыткой публикации,
+	// поэтому должна быть заметно больше outboxMaxBackoff.
+	outboxLease = 2 * time.Minute
+	// outboxRequeueInterval — как часто сообщения с истекшей арендой возвращаются в очередь.
+	outboxRequeueInterval = 30 * time.Second
+)
+
+// Outbox реализует EventPublisher поверх персистентной очереди в хранилище.
+// PublishBlockMessage только сохраняет сообщение, а Run асинхронно публикует
+// накопленные сообщения через target, повторяя попытки, пока брокер не подтвердит прием.
+// Благодаря этому воркеры обработки логов не ждут брокер, а сообщения переживают
+// его недоступность и перезапуск observer.
+type Outbox struct {
+	store  storage.OutboxStore
+	target EventPublisher
+}
+
+// NewOutbox создает новый outbox поверх хранилища и целевого издателя.
+func NewOutbox(store storage.OutboxStore, target EventPublisher) *Outbox {
+	return &Outbox{
+		store:  store,
+		target: target,
+	}
+}
+
+// PublishBlockMessage сохраняет сообщение о блокировке в outbox для последующей отправки.
+func (o *Outbox) PublishBlockMessage(msg models.BlockMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxOpTimeout)
+	defer cancel()
+
+	if err := o.store.EnqueueOutbox(ctx, msg); err != nil {
+		return fmt.Errorf("не удалось поставить сообщение о блокировке в outbox: %w", err)
+	}
+	return nil
+}
+
+// Run публикует сообщения из outbox до отмены контекста.
+func (o *Outbox) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Println("Запуск отправки сообщений о блокировке из outbox...")
+	var lastRequeue time.Time
+	for {
+		if ctx.Err() != nil {
+			log.Println("Остановка отправки сообщений из outbox.")
+			return
+		}
+
+		if time.Since(lastRequeue) >= outboxRequeueInterval {
+			o.requeueExpired(ctx)
+			lastRequeue = time.Now()
+		}
+
+		entry, err := o.store.ClaimOutbox(ctx, outboxClaimWait, outboxLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Ошибка чтения outbox: %v", err)
+				o.sleep(ctx, outboxMinBackoff)
+			}
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		o.deliver(ctx, entry)
+	}
+}
+
+// requeueExpired возвращает в очередь сообщения, аренда которых истекла у упавших или
+// остановленных экземпляров observer.
+func (o *Outbox) requeueExpired(ctx context.Context) {
+	requeued, err := o.store.RequeueOutbox(ctx, outboxLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Ошибка возврата неподтвержденных сообщений в outbox: %v", err)
+		}
+		return
+	}
+	if requeued > 0 {
+		log.Printf("В outbox возвращено %d неподтвержденных сообщений с истекшей арендой.", requeued)
+	}
+}
+
+// deliver публикует сообщение, повторяя попытки с экспоненциальной задержкой.
+// При остановке сервиса сообщение остается в outbox и будет отправлено после перезапуска.
+func (o *Outbox) deliver(ctx context.Context, entry *storage.OutboxEntry) {
+	backoff := outboxMinBackoff
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			renewCtx, cancel := context.WithTimeout(ctx, outboxOpTimeout)
+			if err := o.store.RenewOutbox(renewCtx, entry, outboxLease); err != nil {
+				log.Printf("Ошибка продления аренды блокировки %s в outbox: %v", entry.Message.BlockID, err)
+			}
+			cancel()
+		}
+		err := o.target.PublishBlockMessage(entry.Message)
+		if err == nil {
+			break
+		}
+		log.Printf("Не удалось опубликовать блокировку %s (попытка %d): %v. Повтор через %v...", entry.Message.BlockID, attempt, err, backoff)
+		if !o.sleep(ctx, backoff) {
+			return
+		}
+		backoff *= 2
+		if backoff > outboxMaxBackoff {
+			backoff = outboxMaxBackoff
+		}
+	}
+
+	ackCtx, cancel := context.WithTimeout(context.Background(), outboxOpTimeout)
+	defer cancel()
+	if err := o.store.AckOutbox(ackCtx, entry); err != nil {
+		log.Printf("Ошибка подтверждения блокировки %s в outbox: %v", entry.Message.BlockID, err)
+		return
+	}
+	log.Printf("Блокировка %s опубликована в брокер и подтверждена.", entry.Message.BlockID)
+}
+
+// sleep ждет d или отмены контекста. Возвращает false, если контекст отменен.
+func (o *Outbox) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Ping проверяет состояние целевого издателя.
+func (o *Outbox) Ping() error {
+	return o.target.Ping()
+}
+
+// Close закрывает целевого издателя.
+func (o *Outbox) Close() error {
+	return o.target.Close()
+}
@@ -1,46 +1,53 @@
 package publisher
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"observer_service/internal/models"
+	"observer_service/internal/services/signing"
 	"sync"
 	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// confirmTimeout ограничивает ожидание подтверждения публикации от брокера.
+const confirmTimeout = 5 * time.Second
+
 // EventPublisher определяет интерфейс для публикации событий.
 type EventPublisher interface {
-	PublishBlockMessage(ips []string, duration string) error
+	PublishBlockMessage(msg models.BlockMessage) error
 	Close() error
 	Ping() error
 }
 
 // RabbitMQPublisher реализует EventPublisher для RabbitMQ.
+// Канал работает в режиме publisher confirms: публикация считается успешной
+// только после подтверждения брокером. Если задан signer, каждая команда подписывается.
 type RabbitMQPublisher struct {
 	conn         *amqp091.Connection
 	channel      *amqp091.Channel
 	exchangeName string
 	url          string
+	signer       *signing.Signer
 	mux          sync.Mutex
-	maxRetries   int
-	retryDelay   time.Duration
 }
 
 // NewRabbitMQPublisher создает и настраивает нового издателя RabbitMQ.
-func NewRabbitMQPublisher(url, exchangeName string) (*RabbitMQPublisher, error) {
+// Если брокер недоступен, издатель создается без соединения и подключится при первой публикации.
+// signer может быть nil — тогда команды публикуются без подписи.
+func NewRabbitMQPublisher(url, exchangeName string, signer *signing.Signer) (*RabbitMQPublisher, error) {
 	p := &RabbitMQPublisher{
 		url:          url,
 		exchangeName: exchangeName,
-		maxRetries:   5,
-		retryDelay:   2 * time.Second,
+		signer:       signer,
 	}
 
-	if err := p.connectWithRetry(); err != nil {
-		return nil, fmt.Errorf("не удалось подключиться к RabbitMQ при инициализации: %w", err)
+	if err := p.connect(); err != nil {
+		log.Printf("RabbitMQ недоступен при запуске: %v. Сообщения будут накапливаться в outbox.", err)
 	}
 
 	return p, nil
@@ -73,73 +80,83 @@ func (p *RabbitMQPublisher) connect() error {
 		return fmt.Errorf("ошибка создания exchange: %w", err)
 	}
 
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		conn.Close()
+		return fmt.Errorf("ошибка включения publisher confirms: %w", err)
+	}
+
 	p.conn = conn
 	p.channel = ch
 	log.Println("Успешное (пере)подключение к RabbitMQ и настройка канала.")
 	return nil
 }
 
-func (p *RabbitMQPublisher) connectWithRetry() error {
-	var err error
-	for i := 0; i < p.maxRetries; i++ {
-		err = p.connect()
-		if err == nil {
-			return nil
-		}
-		log.Printf("Не удалось подключиться к RabbitMQ (попытка %d/%d): %v. Повтор через %v...", i+1, p.maxRetries, err, p.retryDelay)
-		time.Sleep(p.retryDelay)
-	}
-	return fmt.Errorf("не удалось подключиться к RabbitMQ после %d попыток: %w", p.maxRetries, err)
-}
-
-// PublishBlockMessage публикует сообщение о блокировке с логикой переподключения.
-func (p *RabbitMQPublisher) PublishBlockMessage(ips []string, duration string) error {
+// PublishBlockMessage публикует сообщение о блокировке и ждет подтверждения брокера.
+// Выполняет одну попытку (с переподключением при потерянном соединении);
+// повторные попытки выполняет вызывающая сторона (см. Outbox).
+func (p *RabbitMQPublisher) PublishBlockMessage(blockMsg models.BlockMessage) error {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	blockMsg := models.BlockMessage{
-		IPs:      ips,
-		Duration: duration,
-	}
 	body, err := json.Marshal(blockMsg)
 	if err != nil {
 		return fmt.Errorf("ошибка сериализации сообщения о блокировке: %w", err)
 	}
 
-	for i := 0; i < p.maxRetries; i++ {
-		if p.conn == nil || p.conn.IsClosed() {
-			log.Println("Соединение с RabbitMQ потеряно. Попытка переподключения...")
-			if err := p.connectWithRetry(); err != nil {
-				log.Printf("Не удалось восстановить соединение с RabbitMQ: %v", err)
-				time.Sleep(p.retryDelay)
-				continue
-			}
-		}
+	// Подпись создается заново при каждой попытке, чтобы время подписи отражало момент отправки.
+	headers, err := p.signer.Headers(body)
+	if err != nil {
+		return fmt.Errorf("ошибка подписи сообщения о блокировке: %w", err)
+	}
 
-		err = p.channel.Publish(
-			p.exchangeName,
-			"",
-			false,
-			false,
-			amqp091.Publishing{
-				ContentType:  "application/json",
-				Body:         body,
-				DeliveryMode: amqp091.Persistent,
-			},
-		)
-
-		if err == nil {
-			return nil // Успех
+	if p.conn == nil || p.conn.IsClosed() || p.channel == nil || p.channel.IsClosed() {
+		p.closeConnection()
+		if err := p.connect(); err != nil {
+			return err
 		}
+	}
 
-		log.Printf("Ошибка публикации сообщения в RabbitMQ (попытка %d/%d): %v. Повтор...", i+1, p.maxRetries, err)
-		if p.conn != nil {
-			p.conn.Close() // Принудительно закрываем, чтобы пересоздать на следующей итерации
-		}
-		time.Sleep(p.retryDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		p.exchangeName,
+		"",
+		false,
+		false,
+		amqp091.Publishing{
+			Headers:      headers,
+			ContentType:  "application/json",
+			MessageId:    blockMsg.BlockID,
+			Body:         body,
+			DeliveryMode: amqp091.Persistent,
+		},
+	)
+	if err != nil {
+		p.closeConnection() // Пересоздадим соединение при следующей попытке
+		return fmt.Errorf("ошибка публикации сообщения в RabbitMQ: %w", err)
 	}
 
-	return fmt.Errorf("критическая ошибка: не удалось опубликовать сообщение в RabbitMQ после %d попыток", p.maxRetries)
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		p.closeConnection()
+		return fmt.Errorf("не получено подтверждение публикации от RabbitMQ: %w", err)
+	}
+	if !acked {
+		return errors.New("RabbitMQ отклонил сообщение о блокировке (nack)")
+	}
+	return nil
+}
+
+// closeConnection закрывает текущее соединение. Вызывается под мьютексом.
+func (p *RabbitMQPublisher) closeConnection() {
+	if p.conn != nil && !p.conn.IsClosed() {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.channel = nil
 }
 
 // Ping проверяет текущее состояние соединения с RabbitMQ без попытки переподключения.
@@ -158,8 +175,11 @@ func (p *RabbitMQPublisher) Ping() error {
 
 // Close закрывает соединение с RabbitMQ.
 func (p *RabbitMQPublisher) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
 	if p.conn != nil && !p.conn.IsClosed() {
 		return p.conn.Close()
 	}
 	return nil
-}
\ No newline at end of file
+}
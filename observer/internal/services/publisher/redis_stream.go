@@ -0,0 +1,85 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"observer_service/internal/models"
+	"observer_service/internal/services/signing"
+	"observer_service/internal/services/storage"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// streamBodyField — поле записи потока с телом команды; остальные поля передаются как заголовки.
+const streamBodyField = "body"
+
+// RedisStreamPublisher реализует EventPublisher поверх Redis Streams.
+// Каждая нода читает поток своей группой потребителей, поэтому команда доходит до всех нод.
+// Поток ограничивается примерно maxLen последними записями.
+type RedisStreamPublisher struct {
+	client redis.UniversalClient
+	stream string
+	maxLen int64
+	signer *signing.Signer
+}
+
+// NewRedisStreamPublisher создает издателя команд в Redis Stream.
+// signer может быть nil — тогда команды публикуются без подписи.
+func NewRedisStreamPublisher(redisMode, redisURL, stream string, maxLen int, signer *signing.Signer) (*RedisStreamPublisher, error) {
+	client, err := storage.NewRedisClient(redisMode, redisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStreamPublisher{
+		client: client,
+		stream: stream,
+		maxLen: int64(maxLen),
+		signer: signer,
+	}, nil
+}
+
+// PublishBlockMessage добавляет команду блокировки в поток. XADD атомарен, поэтому
+// успешный ответ Redis означает, что команда сохранена.
+func (p *RedisStreamPublisher) PublishBlockMessage(blockMsg models.BlockMessage) error {
+	body, err := json.Marshal(blockMsg)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации сообщения о блокировке: %w", err)
+	}
+
+	headers, err := p.signer.Headers(body)
+	if err != nil {
+		return fmt.Errorf("ошибка подписи сообщения о блокировке: %w", err)
+	}
+	values := map[string]interface{}{streamBodyField: body}
+	for k, v := range headers {
+		values[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("ошибка публикации сообщения в Redis Stream: %w", err)
+	}
+	return nil
+}
+
+// Ping проверяет соединение с Redis.
+func (p *RedisStreamPublisher) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return p.client.Ping(ctx).Err()
+}
+
+// Close закрывает соединение с Redis.
+func (p *RedisStreamPublisher) Close() error {
+	return p.client.Close()
+}
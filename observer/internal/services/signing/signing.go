@@ -0,0 +1,108 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки сообщения, в которых передается подпись команды.
+const (
+	HeaderSignature = "x-signature"
+	HeaderTimestamp = "x-signature-timestamp"
+	HeaderNonce     = "x-signature-nonce"
+)
+
+// signaturePrefix отделяет подписи команд observer от любых других подписей тем же ключом.
+const signaturePrefix = "remnawave-observer/v1"
+
+// Signature — подпись сообщения: Ed25519 над префиксом, временем, nonce и телом.
+type Signature struct {
+	Timestamp int64
+	Nonce     string
+	Value     string
+}
+
+// Headers возвращает подпись в виде заголовков сообщения.
+func (s Signature) Headers() map[string]interface{} {
+	return map[string]interface{}{
+		HeaderSignature: s.Value,
+		HeaderTimestamp: strconv.FormatInt(s.Timestamp, 10),
+		HeaderNonce:     s.Nonce,
+	}
+}
+
+// Signer подписывает команды блокировки приватным ключом observer.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner создает Signer из ключа в base64: 32-байтного seed или полного 64-байтного приватного ключа.
+func NewSigner(encoded string) (*Signer, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("ключ подписи не является base64: %w", err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return &Signer{key: ed25519.NewKeyFromSeed(raw)}, nil
+	case ed25519.PrivateKeySize:
+		return &Signer{key: ed25519.PrivateKey(raw)}, nil
+	default:
+		return nil, fmt.Errorf("ключ подписи должен содержать %d или %d байт, получено %d",
+			ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// Sign подписывает тело сообщения с текущим временем и случайным nonce.
+func (s *Signer) Sign(body []byte) (Signature, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Signature{}, fmt.Errorf("не удалось сгенерировать nonce: %w", err)
+	}
+
+	sig := Signature{
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	sig.Value = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, SignedMessage(sig.Timestamp, sig.Nonce, body)))
+	return sig, nil
+}
+
+// Headers подписывает тело и возвращает заголовки подписи. Для nil Signer (подпись отключена) возвращает nil.
+func (s *Signer) Headers(body []byte) (map[string]interface{}, error) {
+	if s == nil {
+		return nil, nil
+	}
+	sig, err := s.Sign(body)
+	if err != nil {
+		return nil, err
+	}
+	return sig.Headers(), nil
+}
+
+// PublicKey возвращает публичный ключ в base64 для настройки блокировщиков.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// GenerateKey создает новую пару ключей: seed приватного ключа и публичный ключ в base64.
+func GenerateKey() (privateKey, publicKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.Seed()), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// SignedMessage собирает байты, которые покрывает подпись.
+func SignedMessage(timestamp int64, nonce string, body []byte) []byte {
+	header := fmt.Sprintf("%s\n%d\n%s\n", signaturePrefix, timestamp, nonce)
+	return append([]byte(header), body...)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// activeUsersKey — индекс активных пользователей: отсортированное множество email -> время
+// последней активности (unix ms). Позволяет обходить пользователей без SCAN по всем ключам.
+// Индекс обновляется в том же конвейере, что и проверки IP, а не внутри Lua-скрипта:
+// в Redis Cluster он находится в другом слоте, чем ключи пользователя.
+const activeUsersKey = "active_users"
+
+// ErrInvalidCursor возвращается ListActiveUsers для курсора, выданного не этим хранилищем.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// touchActiveUsers добавляет в конвейер обновление времени активности пользователей пачки.
+func touchActiveUsers(ctx context.Context, pipe redis.Pipeliner, requests []models.CheckRequest) {
+	now := float64(time.Now().UnixMilli())
+	members := make([]redis.Z, 0, len(requests))
+	seen := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		if !seen[req.Email] {
+			seen[req.Email] = true
+			members = append(members, redis.Z{Score: now, Member: req.Email})
+		}
+	}
+	pipe.ZAdd(ctx, activeUsersKey, members...)
+}
+
+// ListActiveUsers возвращает страницу индекса через ZSCAN: курсор устойчив к изменениям
+// индекса во время обхода, а count — лишь подсказка о размере страницы.
+func (s *RedisStore) ListActiveUsers(ctx context.Context, cursor string, count int) ([]models.ActiveUser, string, error) {
+	var position uint64
+	if cursor != "" {
+		var err error
+		if position, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("%w: '%s'", ErrInvalidCursor, cursor)
+		}
+	}
+
+	pairs, next, err := s.client.ZScan(ctx, activeUsersKey, position, "", int64(count)).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка чтения индекса активных пользователей: %w", err)
+	}
+
+	users := make([]models.ActiveUser, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(pairs[i+1], 64)
+		if err != nil {
+			continue
+		}
+		users = append(users, models.ActiveUser{Email: pairs[i], LastSeen: time.UnixMilli(int64(score))})
+	}
+
+	nextCursor := ""
+	if next != 0 {
+		nextCursor = strconv.FormatUint(next, 10)
+	}
+	return users, nextCursor, nil
+}
+
+// PruneInactiveUsers удаляет из индекса пользователей, последняя активность которых раньше before.
+func (s *RedisStore) PruneInactiveUsers(ctx context.Context, before time.Time) (int, error) {
+	pruned, err := s.client.ZRemRangeByScore(ctx, activeUsersKey, "-inf", "("+strconv.FormatInt(before.UnixMilli(), 10)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки индекса активных пользователей: %w", err)
+	}
+	return int(pruned), nil
+}
+
+// rebuildActiveUsers однократно заполняет индекс по существующим ключам user_ips:{email}
+// (после обновления с версии без индекса). Время активности неизвестно, поэтому
+// используется текущее: лишние записи снимет PruneInactiveUsers.
+func (s *RedisStore) rebuildActiveUsers(ctx context.Context) error {
+	exists, err := s.client.Exists(ctx, activeUsersKey).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	var emails []string
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		// SCAN обходит только ключи своего узла, поэтому сканируется каждый мастер.
+		var mu sync.Mutex
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			nodeEmails, err := scanUserEmails(ctx, node)
+			mu.Lock()
+			emails = append(emails, nodeEmails...)
+			mu.Unlock()
+			return err
+		})
+	} else {
+		emails, err = scanUserEmails(ctx, s.client)
+	}
+	if err != nil || len(emails) == 0 {
+		return err
+	}
+
+	now := float64(time.Now().UnixMilli())
+	members := make([]redis.Z, len(emails))
+	for i, email := range emails {
+		members[i] = redis.Z{Score: now, Member: email}
+	}
+	if err := s.client.ZAdd(ctx, activeUsersKey, members...).Err(); err != nil {
+		return err
+	}
+	log.Printf("Индекс активных пользователей построен: %d пользователей.", len(emails))
+	return nil
+}
+
+// scanUserEmails собирает пользователей по ключам user_ips:{email} одного узла.
+func scanUserEmails(ctx context.Context, client redis.Cmdable) ([]string, error) {
+	var emails []string
+	iter := client.Scan(ctx, 0, "user_ips:{*}", 500).Iterator()
+	for iter.Next(ctx) {
+		if email, ok := strings.CutPrefix(iter.Val(), "user_ips:{"); ok && strings.HasSuffix(email, "}") {
+			emails = append(emails, strings.TrimSuffix(email, "}"))
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при сканировании ключей (SCAN): %w", err)
+	}
+	return emails, nil
+}
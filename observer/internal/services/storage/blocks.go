@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"observer_service/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// activeBlocksKey — отсортированное множество активных блокировок: IP -> время истечения (unix ms).
+const activeBlocksKey = "active_blocks"
+
+// BlockStore определяет интерфейс для хранения активных блокировок,
+// по которому блокировщики синхронизируют свое состояние.
+type BlockStore interface {
+	AddActiveBlocks(ctx context.Context, ips []string, duration time.Duration) error
+	GetActiveBlocks(ctx context.Context) ([]models.ActiveBlock, error)
+}
+
+// AddActiveBlocks сохраняет IP-адреса как заблокированные на duration.
+// Если IP уже заблокирован на больший срок, время истечения не сокращается.
+func (s *RedisStore) AddActiveBlocks(ctx context.Context, ips []string, duration time.Duration) error {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	expiresAt := float64(time.Now().Add(duration).UnixMilli())
+	members := make([]redis.Z, 0, len(ips))
+	for _, ip := range ips {
+		members = append(members, redis.Z{Score: expiresAt, Member: ip})
+	}
+
+	if err := s.client.ZAddGT(ctx, activeBlocksKey, members...).Err(); err != nil {
+		return fmt.Errorf("ошибка сохранения активных блокировок: %w", err)
+	}
+	return nil
+}
+
+// GetActiveBlocks удаляет истекшие блокировки и возвращает оставшиеся.
+func (s *RedisStore) GetActiveBlocks(ctx context.Context) ([]models.ActiveBlock, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := s.client.ZRemRangeByScore(ctx, activeBlocksKey, "-inf", now).Err(); err != nil {
+		return nil, fmt.Errorf("ошибка удаления истекших блокировок: %w", err)
+	}
+
+	entries, err := s.client.ZRangeWithScores(ctx, activeBlocksKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения активных блокировок: %w", err)
+	}
+
+	blocks := make([]models.ActiveBlock, 0, len(entries))
+	for _, entry := range entries {
+		ip, ok := entry.Member.(string)
+		if !ok {
+			continue
+		}
+		blocks = append(blocks, models.ActiveBlock{
+			IP:        ip,
+			ExpiresAt: time.UnixMilli(int64(entry.Score)),
+		})
+	}
+	return blocks, nil
+}
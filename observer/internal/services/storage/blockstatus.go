@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"observer_service/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// blockStatusKeyPrefix — хеш состояния блокировки: поле blockStatusMetaField — описание
+	// блокировки (JSON), поля node:<id> — отчеты нод (JSON). Хеш-тег держит ключ в одном слоте.
+	blockStatusKeyPrefix = "block_status:"
+	blockStatusMetaField = "meta"
+	blockStatusNodeField = "node:"
+	// blockStatusRecentKey — отсортированное множество блокировок: ID -> время публикации (unix ms).
+	blockStatusRecentKey = "block_status:recent"
+	// blockNodesKey — отсортированное множество нод: ID ноды -> время последнего отчета (unix ms).
+	blockNodesKey = "block_nodes"
+	// blockStatusTTL — сколько хранится состояние блокировки.
+	blockStatusTTL = 24 * time.Hour
+	// maxRecentBlocks ограничивает индекс последних блокировок.
+	maxRecentBlocks = 1000
+)
+
+// recordBlockResultScript сохраняет отчет ноды, только если блокировка зарегистрирована:
+// отчеты по неизвестным или истекшим блокировкам не создают ключей без TTL.
+//
+// KEYS[1]: ключ состояния блокировки
+// ARGV[1]: поле отчета ноды, ARGV[2]: отчет (JSON)
+const recordBlockResultScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`
+
+var recordBlockResult = redis.NewScript(recordBlockResultScript)
+
+// BlockStatusStore определяет интерфейс хранения состояния блокировок и отчетов нод.
+// Состояние общее для всех экземпляров observer: отчет, полученный одним экземпляром,
+// виден в /admin/blocks и в сводке любого другого.
+type BlockStatusStore interface {
+	SaveBlockStatus(ctx context.Context, status models.BlockStatus) error
+	DeleteBlockStatus(ctx context.Context, blockID string) error
+	RecordBlockResult(ctx context.Context, result models.BlockResult) (bool, error)
+	GetBlockStatus(ctx context.Context, blockID string) (models.BlockStatus, bool, error)
+	RecentBlockStatuses(ctx context.Context, limit int) ([]models.BlockStatus, error)
+	TouchNode(ctx context.Context, nodeID string, at time.Time) error
+	ActiveNodes(ctx context.Context, since time.Time) ([]string, error)
+}
+
+func blockStatusKey(blockID string) string {
+	return blockStatusKeyPrefix + "{" + blockID + "}"
+}
+
+// SaveBlockStatus регистрирует блокировку. Отчеты нод хранятся в том же хеше и истекают вместе с ним.
+func (s *RedisStore) SaveBlockStatus(ctx context.Context, status models.BlockStatus) error {
+	status.Nodes = nil
+	meta, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации состояния блокировки %s: %w", status.BlockID, err)
+	}
+
+	key := blockStatusKey(status.BlockID)
+	cutoff := strconv.FormatInt(time.Now().Add(-blockStatusTTL).UnixMilli(), 10)
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, key, blockStatusMetaField, meta)
+		pipe.Expire(ctx, key, blockStatusTTL)
+		pipe.ZAdd(ctx, blockStatusRecentKey, redis.Z{Score: float64(status.PublishedAt.UnixMilli()), Member: status.BlockID})
+		pipe.ZRemRangeByScore(ctx, blockStatusRecentKey, "-inf", cutoff)
+		pipe.ZRemRangeByRank(ctx, blockStatusRecentKey, 0, -maxRecentBlocks-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния блокировки %s: %w", status.BlockID, err)
+	}
+	return nil
+}
+
+// DeleteBlockStatus удаляет блокировку, например если ее не удалось опубликовать.
+func (s *RedisStore) DeleteBlockStatus(ctx context.Context, blockID string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, blockStatusKey(blockID))
+		pipe.ZRem(ctx, blockStatusRecentKey, blockID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка удаления состояния блокировки %s: %w", blockID, err)
+	}
+	return nil
+}
+
+// RecordBlockResult сохраняет отчет ноды. Возвращает false, если блокировка неизвестна или истекла.
+func (s *RedisStore) RecordBlockResult(ctx context.Context, result models.BlockResult) (bool, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации отчета ноды %s: %w", result.NodeID, err)
+	}
+	stored, err := recordBlockResult.Run(ctx, s.client, []string{blockStatusKey(result.BlockID)},
+		blockStatusNodeField+result.NodeID, raw).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения отчета ноды %s по блокировке %s: %w", result.NodeID, result.BlockID, err)
+	}
+	return stored == 1, nil
+}
+
+// GetBlockStatus возвращает описание блокировки и отчеты нод. Счетчики и сводка не заполняются.
+func (s *RedisStore) GetBlockStatus(ctx context.Context, blockID string) (models.BlockStatus, bool, error) {
+	fields, err := s.client.HGetAll(ctx, blockStatusKey(blockID)).Result()
+	if err != nil {
+		return models.BlockStatus{}, false, fmt.Errorf("ошибка чтения состояния блокировки %s: %w", blockID, err)
+	}
+	return decodeBlockStatus(blockID, fields)
+}
+
+// RecentBlockStatuses возвращает последние limit блокировок, начиная с самых новых.
+func (s *RedisStore) RecentBlockStatuses(ctx context.Context, limit int) ([]models.BlockStatus, error) {
+	if limit <= 0 || limit > maxRecentBlocks {
+		limit = maxRecentBlocks
+	}
+	ids, err := s.client.ZRevRange(ctx, blockStatusRecentKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка блокировок: %w", err)
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, blockStatusKey(id))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("ошибка чтения состояния блокировок: %w", err)
+	}
+
+	statuses := make([]models.BlockStatus, 0, len(ids))
+	for i, id := range ids {
+		status, ok, err := decodeBlockStatus(id, cmds[i].Val())
+		if err != nil || !ok {
+			continue // Истекшая или поврежденная запись; индекс очистится при следующей регистрации
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// decodeBlockStatus собирает состояние блокировки из полей ее хеша.
+func decodeBlockStatus(blockID string, fields map[string]string) (models.BlockStatus, bool, error) {
+	meta, ok := fields[blockStatusMetaField]
+	if !ok {
+		return models.BlockStatus{}, false, nil
+	}
+	var status models.BlockStatus
+	if err := json.Unmarshal([]byte(meta), &status); err != nil {
+		return models.BlockStatus{}, false, fmt.Errorf("поврежденное состояние блокировки %s: %w", blockID, err)
+	}
+
+	status.Nodes = make(map[string]models.BlockResult)
+	for field, raw := range fields {
+		nodeID, isNode := strings.CutPrefix(field, blockStatusNodeField)
+		if !isNode {
+			continue
+		}
+		var result models.BlockResult
+		if err := json.Unmarshal([]byte(raw), &result); err != nil {
+			continue
+		}
+		status.Nodes[nodeID] = result
+	}
+	return status, true, nil
+}
+
+// TouchNode отмечает, что нода прислала отчет в момент at.
+func (s *RedisStore) TouchNode(ctx context.Context, nodeID string, at time.Time) error {
+	if err := s.client.ZAdd(ctx, blockNodesKey, redis.Z{Score: float64(at.UnixMilli()), Member: nodeID}).Err(); err != nil {
+		return fmt.Errorf("ошибка обновления списка нод: %w", err)
+	}
+	return nil
+}
+
+// ActiveNodes удаляет ноды, не отчитывавшиеся с момента since, и возвращает остальные
+// в порядке возрастания идентификатора.
+func (s *RedisStore) ActiveNodes(ctx context.Context, since time.Time) ([]string, error) {
+	cutoff := "(" + strconv.FormatInt(since.UnixMilli(), 10)
+	if err := s.client.ZRemRangeByScore(ctx, blockNodesKey, "-inf", cutoff).Err(); err != nil {
+		return nil, fmt.Errorf("ошибка удаления неактивных нод: %w", err)
+	}
+	nodes, err := s.client.ZRange(ctx, blockNodesKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка нод: %w", err)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltUsersBucket — бакет с состоянием пользователей: email -> userIPs в JSON.
+var boltUsersBucket = []byte("user_ips")
+
+// BoltStore реализует IPStorage во встроенной базе bbolt (один файл на диске) с той же
+// семантикой, что и RedisStore. В отличие от MemoryStore, IP пользователей и кулдауны
+// переживают перезапуск observer. Файл может открыть только один процесс.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore открывает (или создает) базу bbolt по пути path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы bbolt '%s': %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка создания бакета bbolt: %w", err)
+	}
+	log.Printf("IP пользователей хранятся в базе bbolt '%s'.", path)
+	return &BoltStore{db: db}, nil
+}
+
+// loadUser читает состояние пользователя; отсутствующий пользователь — пустое состояние.
+func loadUser(b *bolt.Bucket, email string) (*userIPs, error) {
+	u := &userIPs{}
+	raw := b.Get([]byte(email))
+	if raw == nil {
+		return u, nil
+	}
+	if err := json.Unmarshal(raw, u); err != nil {
+		return nil, fmt.Errorf("поврежденная запись пользователя %s: %w", email, err)
+	}
+	return u, nil
+}
+
+// storeUser сохраняет состояние пользователя или удаляет запись, если от него ничего не осталось.
+func storeUser(b *bolt.Bucket, email string, u *userIPs, now int64) error {
+	if u.expire(now) {
+		return b.Delete([]byte(email))
+	}
+	raw, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(email), raw)
+}
+
+// CheckAndAddIP атомарно (в одной транзакции) добавляет IP и проверяет лимит пользователя.
+func (s *BoltStore) CheckAndAddIP(ctx context.Context, email, ip string, limit int, ttl, cooldown time.Duration) (*models.CheckResult, error) {
+	results := s.CheckAndAddIPs(ctx, []models.CheckRequest{{Email: email, IP: ip, Limit: limit}}, ttl, cooldown)
+	if err := results[0].Err; err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// CheckAndAddIPs выполняет проверки пачки записей по порядку в одной транзакции.
+// Ошибка транзакции возвращается в поле Err каждой записи: изменения откатываются целиком.
+func (s *BoltStore) CheckAndAddIPs(ctx context.Context, requests []models.CheckRequest, ttl, cooldown time.Duration) []models.CheckResult {
+	results := make([]models.CheckResult, len(requests))
+	if len(requests) == 0 {
+		return results
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		now := nowMillis()
+		users := make(map[string]*userIPs)
+		for i, req := range requests {
+			u, ok := users[req.Email]
+			if !ok {
+				var err error
+				if u, err = loadUser(b, req.Email); err != nil {
+					return err
+				}
+				users[req.Email] = u
+			}
+			results[i] = u.check(req.IP, req.Limit, ttl, cooldown, now)
+		}
+		for email, u := range users {
+			if err := storeUser(b, email, u, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("ошибка записи в bbolt: %w", err)
+		for i := range results {
+			results[i] = models.CheckResult{Err: err}
+		}
+	}
+	return results
+}
+
+// ClearUserIPs удаляет все IP пользователя; кулдаун алертов сохраняется.
+func (s *BoltStore) ClearUserIPs(ctx context.Context, email string) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		u, err := loadUser(b, email)
+		if err != nil {
+			return err
+		}
+		now := nowMillis()
+		deleted = u.clear(now)
+		return storeUser(b, email, u, now)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки IP для %s в bbolt: %w", email, err)
+	}
+	return deleted, nil
+}
+
+// GetUserActiveIPs возвращает активные IP пользователя с их TTL в секундах.
+func (s *BoltStore) GetUserActiveIPs(ctx context.Context, userEmail string) (map[string]int, error) {
+	var active map[string]int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		u, err := loadUser(tx.Bucket(boltUsersBucket), userEmail)
+		if err != nil {
+			return err
+		}
+		active = u.activeIPs(nowMillis())
+		return nil
+	})
+	return active, err
+}
+
+// ListActiveUsers возвращает страницу индекса активных пользователей в порядке email
+// (ключи bbolt отсортированы). Курсор — email последнего пользователя предыдущей страницы.
+func (s *BoltStore) ListActiveUsers(ctx context.Context, cursor string, count int) ([]models.ActiveUser, string, error) {
+	var users []models.ActiveUser
+	next := ""
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltUsersBucket).Cursor()
+		k, v := c.Seek([]byte(cursor))
+		if k != nil && string(k) == cursor {
+			k, v = c.Next()
+		}
+		for ; k != nil; k, v = c.Next() {
+			u := &userIPs{}
+			if err := json.Unmarshal(v, u); err != nil {
+				return fmt.Errorf("поврежденная запись пользователя %s: %w", k, err)
+			}
+			user, ok := u.activeUser(string(k))
+			if !ok {
+				continue
+			}
+			if len(users) == count {
+				next = users[count-1].Email
+				return nil
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка чтения пользователей из bbolt: %w", err)
+	}
+	return users, next, nil
+}
+
+// PruneInactiveUsers снимает с индекса пользователей без активности с before и удаляет
+// истекшие записи.
+func (s *BoltStore) PruneInactiveUsers(ctx context.Context, before time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		now := nowMillis()
+		changed := make(map[string]*userIPs)
+		err := b.ForEach(func(k, v []byte) error {
+			u := &userIPs{}
+			if err := json.Unmarshal(v, u); err != nil {
+				return fmt.Errorf("поврежденная запись пользователя %s: %w", k, err)
+			}
+			if u.prune(before.UnixMilli()) {
+				pruned++
+				changed[string(k)] = u
+			} else if u.expire(now) {
+				changed[string(k)] = u
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Изменять бакет внутри ForEach нельзя, поэтому записи сохраняются после обхода.
+		for email, u := range changed {
+			if err := storeUser(b, email, u, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки индекса пользователей в bbolt: %w", err)
+	}
+	return pruned, nil
+}
+
+// HasAlertCooldown проверяет, действует ли кулдаун алертов пользователя.
+func (s *BoltStore) HasAlertCooldown(ctx context.Context, userEmail string) (bool, error) {
+	var has bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		u, err := loadUser(tx.Bucket(boltUsersBucket), userEmail)
+		if err != nil {
+			return err
+		}
+		has = u.hasCooldown(nowMillis())
+		return nil
+	})
+	return has, err
+}
+
+// Ping проверяет, что база открыта.
+func (s *BoltStore) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// Close закрывает базу bbolt.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,17 @@
+package storage_test
+
+import (
+	"observer_service/internal/services/storage"
+	"observer_service/internal/services/storage/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	store, err := storage.NewBoltStore(filepath.Join(t.TempDir(), "ips.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	storagetest.TestIPStorage(t, store)
+}
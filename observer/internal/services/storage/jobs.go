@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"observer_service/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// jobsQueueKey — отсортированное множество отложенных задач: ID -> время выполнения (unix ms).
+	jobsQueueKey = "{delayed_jobs}"
+	// jobsPayloadKey — хеш ID -> JSON задачи. Хеш-тег помещает его в слот jobsQueueKey.
+	jobsPayloadKey = "{delayed_jobs}:payload"
+)
+
+// claimJobsScript атомарно забирает наступившие задачи: их время выполнения переносится
+// на конец аренды, поэтому другие экземпляры observer их не видят. Если экземпляр не
+// успеет завершить задачу до конца аренды (например, упадет), она будет выдана снова.
+//
+// KEYS[1]: jobsQueueKey, KEYS[2]: jobsPayloadKey
+// ARGV[1]: текущее время (unix ms), ARGV[2]: максимум задач, ARGV[3]: конец аренды (unix ms)
+// Возвращает пары ID, JSON задачи; ID без данных задачи удаляются из очереди.
+const claimJobsScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local claimed = {}
+for _, id in ipairs(ids) do
+    local payload = redis.call('HGET', KEYS[2], id)
+    if payload then
+        redis.call('ZADD', KEYS[1], ARGV[3], id)
+        table.insert(claimed, id)
+        table.insert(claimed, payload)
+    else
+        redis.call('ZREM', KEYS[1], id)
+    end
+end
+return claimed
+`
+
+var claimJobs = redis.NewScript(claimJobsScript)
+
+// JobStore определяет интерфейс персистентной очереди отложенных задач.
+// Наступившую задачу забирает ровно один экземпляр observer; повторно она выдается,
+// только если не была завершена до конца аренды.
+type JobStore interface {
+	ScheduleJob(ctx context.Context, job models.Job, at time.Time) error
+	ClaimDueJobs(ctx context.Context, limit int, lease time.Duration) ([]models.Job, error)
+	CompleteJob(ctx context.Context, id string) error
+}
+
+// ScheduleJob сохраняет задачу на время at. Задача с тем же ID перезаписывается,
+// поэтому этим же методом задача переносится для повторной попытки.
+func (s *RedisStore) ScheduleJob(ctx context.Context, job models.Job, at time.Time) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи %s: %w", job.ID, err)
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobsPayloadKey, job.ID, payload)
+		pipe.ZAdd(ctx, jobsQueueKey, redis.Z{Score: float64(at.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения задачи %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// ClaimDueJobs забирает не больше limit наступивших задач в аренду на lease.
+func (s *RedisStore) ClaimDueJobs(ctx context.Context, limit int, lease time.Duration) ([]models.Job, error) {
+	now := time.Now()
+	raw, err := claimJobs.Run(ctx, s.client, []string{jobsQueueKey, jobsPayloadKey},
+		strconv.FormatInt(now.UnixMilli(), 10), limit, strconv.FormatInt(now.Add(lease).UnixMilli(), 10)).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения отложенных задач: %w", err)
+	}
+
+	jobs := make([]models.Job, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		id, payload := raw[i], raw[i+1]
+		var job models.Job
+		if err := json.Unmarshal([]byte(payload), &job); err != nil || job.ID != id {
+			log.Printf("Поврежденная отложенная задача %s отброшена: %s", id, payload)
+			if err := s.CompleteJob(ctx, id); err != nil {
+				log.Printf("Ошибка удаления поврежденной задачи %s: %v", id, err)
+			}
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// CompleteJob удаляет выполненную задачу.
+func (s *RedisStore) CompleteJob(ctx context.Context, id string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, jobsQueueKey, id)
+		pipe.HDel(ctx, jobsPayloadKey, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка завершения задачи %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"observer_service/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore реализует IPStorage в памяти процесса с той же семантикой, что и RedisStore
+// (TTL, кулдаун, коды 0/1/2). Подходит для тестов и небольших установок с одним экземпляром
+// observer: данные не переживают перезапуск.
+type MemoryStore struct {
+	mu    sync.Mutex
+	users map[string]*userIPs
+}
+
+// NewMemoryStore создает пустое хранилище в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[string]*userIPs)}
+}
+
+// userLocked возвращает состояние пользователя, при необходимости создавая его.
+func (s *MemoryStore) userLocked(email string) *userIPs {
+	u, ok := s.users[email]
+	if !ok {
+		u = &userIPs{}
+		s.users[email] = u
+	}
+	return u
+}
+
+// CheckAndAddIP атомарно добавляет IP и проверяет лимит пользователя.
+func (s *MemoryStore) CheckAndAddIP(ctx context.Context, email, ip string, limit int, ttl, cooldown time.Duration) (*models.CheckResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.userLocked(email).check(ip, limit, ttl, cooldown, nowMillis())
+	return &res, nil
+}
+
+// CheckAndAddIPs выполняет проверки пачки записей по порядку.
+func (s *MemoryStore) CheckAndAddIPs(ctx context.Context, requests []models.CheckRequest, ttl, cooldown time.Duration) []models.CheckResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := nowMillis()
+	results := make([]models.CheckResult, len(requests))
+	for i, req := range requests {
+		results[i] = s.userLocked(req.Email).check(req.IP, req.Limit, ttl, cooldown, now)
+	}
+	return results
+}
+
+// ClearUserIPs удаляет все IP пользователя; кулдаун алертов сохраняется.
+func (s *MemoryStore) ClearUserIPs(ctx context.Context, email string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[email]
+	if !ok {
+		return 0, nil
+	}
+	now := nowMillis()
+	deleted := u.clear(now)
+	if u.expire(now) {
+		delete(s.users, email)
+	}
+	return deleted, nil
+}
+
+// GetUserActiveIPs возвращает активные IP пользователя с их TTL в секундах.
+func (s *MemoryStore) GetUserActiveIPs(ctx context.Context, userEmail string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userEmail]
+	if !ok {
+		return make(map[string]int), nil
+	}
+	return u.activeIPs(nowMillis()), nil
+}
+
+// ListActiveUsers возвращает страницу индекса активных пользователей в порядке email.
+// Курсор — email последнего пользователя предыдущей страницы.
+func (s *MemoryStore) ListActiveUsers(ctx context.Context, cursor string, count int) ([]models.ActiveUser, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var emails []string
+	for email, u := range s.users {
+		if u.LastSeen != 0 && email > cursor {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+
+	next := ""
+	if len(emails) > count {
+		emails = emails[:count]
+		next = emails[count-1]
+	}
+	users := make([]models.ActiveUser, 0, len(emails))
+	for _, email := range emails {
+		user, _ := s.users[email].activeUser(email)
+		users = append(users, user)
+	}
+	return users, next, nil
+}
+
+// PruneInactiveUsers снимает с индекса пользователей без активности с before и удаляет
+// истекшие записи.
+func (s *MemoryStore) PruneInactiveUsers(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now, pruned := nowMillis(), 0
+	for email, u := range s.users {
+		if u.prune(before.UnixMilli()) {
+			pruned++
+		}
+		if u.expire(now) {
+			delete(s.users, email)
+		}
+	}
+	return pruned, nil
+}
+
+// HasAlertCooldown проверяет, действует ли кулдаун алертов пользователя.
+func (s *MemoryStore) HasAlertCooldown(ctx context.Context, userEmail string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userEmail]
+	return ok && u.hasCooldown(nowMillis()), nil
+}
+
+// Ping всегда успешен: хранилище в памяти доступно, пока работает процесс.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close ничего не делает.
+func (s *MemoryStore) Close() error {
+	return nil
+}
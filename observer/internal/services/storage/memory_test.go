@@ -0,0 +1,13 @@
+package storage_test
+
+import (
+	"observer_service/internal/services/storage"
+	"observer_service/internal/services/storage/storagetest"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := storage.NewMemoryStore()
+	t.Cleanup(func() { store.Close() })
+	storagetest.TestIPStorage(t, store)
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// migrationDoneKey отмечает завершенный перенос: последующие запуски не сканируют ключи.
+// Если при обновлении еще работали старые экземпляры, удалите ключ, и перенос выполнится снова.
+const migrationDoneKey = "migrations:hash_tags"
+
+// migrateLegacyKeys переносит данные из ключей со старыми именами (без хеш-тегов) в новые:
+// IP пользователей с их TTL и кулдауны алертов. RENAME сохраняет TTL ключей. Старые имена
+// могли появиться только на отдельном сервере или за Sentinel, поэтому в режиме кластера
+// перенос не выполняется.
+// После успешного переноса записывается migrationDoneKey, и при следующих запусках перенос пропускается.
+func (s *RedisStore) migrateLegacyKeys(ctx context.Context) error {
+	if isCluster(s.client) {
+		return nil
+	}
+	done, err := s.client.Exists(ctx, migrationDoneKey).Result()
+	if err != nil {
+		return fmt.Errorf("ошибка проверки отметки о переносе ключей: %w", err)
+	}
+	if done > 0 {
+		return nil
+	}
+
+	users := 0
+	iter := s.client.Scan(ctx, 0, "user_ips:*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		email := strings.TrimPrefix(key, "user_ips:")
+		if strings.HasPrefix(email, "{") {
+			continue // Уже новое имя
+		}
+		if err := s.migrateLegacyUser(ctx, email); err != nil {
+			return err
+		}
+		users++
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("ошибка при сканировании ключей (SCAN): %w", err)
+	}
+	if users > 0 {
+		log.Printf("Ключи %d пользователей перенесены в схему с хеш-тегами.", users)
+	}
+	if err := s.client.Set(ctx, migrationDoneKey, time.Now().UTC().Format(time.RFC3339), 0).Err(); err != nil {
+		return fmt.Errorf("ошибка записи отметки о переносе ключей: %w", err)
+	}
+	return nil
+}
+
+// migrateLegacyUser переименовывает ключи одного пользователя. Если новый ключ уже существует
+// (пользователь успел появиться в новой схеме), старый ключ остается истекать сам.
+func (s *RedisStore) migrateLegacyUser(ctx context.Context, email string) error {
+	legacySet := "user_ips:" + email
+	ips, err := s.client.SMembers(ctx, legacySet).Result()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения IP пользователя %s: %w", email, err)
+	}
+	for _, ip := range ips {
+		if err := renameIfExists(ctx, s.client, "ip_ttl:"+email+":"+ip, ipTTLKey(email, ip)); err != nil {
+			return err
+		}
+	}
+	if err := renameIfExists(ctx, s.client, "alert_sent:"+email, alertCooldownKey(email)); err != nil {
+		return err
+	}
+	return renameIfExists(ctx, s.client, legacySet, userIPsKey(email))
+}
+
+// renameIfExists переименовывает ключ, если он существует, а новое имя свободно.
+func renameIfExists(ctx context.Context, client redis.UniversalClient, from, to string) error {
+	err := client.RenameNX(ctx, from, to).Err()
+	if err != nil && !strings.Contains(err.Error(), "no such key") {
+		return fmt.Errorf("ошибка переименования ключа %s: %w", from, err)
+	}
+	return nil
+}
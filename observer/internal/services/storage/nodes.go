@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"observer_service/internal/models"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// nodeTokensKey — хеш SHA-256 токена ноды -> JSON с описанием ноды. Сами токены не хранятся.
+	nodeTokensKey = "node_tokens"
+	// nodeTokenByNodeKey — идентификатор ноды -> хеш ее текущего токена (для отзыва и ротации).
+	// Хеш-тег {node_tokens} помещает ключ в слот nodeTokensKey: оба ключа меняются одним скриптом.
+	nodeTokenByNodeKey = "{node_tokens}:by_node"
+	// nodeTokenPrefix помечает токены нод, чтобы их было легко узнать в конфигурации и утечках.
+	nodeTokenPrefix = "rwo_"
+)
+
+// issueNodeTokenScript атомарно заменяет токен ноды: чтение предыдущего хеша и его удаление
+// выполняются вместе с записью нового, поэтому параллельная ротация не оставит два действующих токена.
+//
+// KEYS[1]: nodeTokensKey, KEYS[2]: nodeTokenByNodeKey
+// ARGV[1]: идентификатор ноды, ARGV[2]: хеш нового токена, ARGV[3]: описание ноды (JSON)
+const issueNodeTokenScript = `
+local previous = redis.call('HGET', KEYS[2], ARGV[1])
+if previous then
+    redis.call('HDEL', KEYS[1], previous)
+end
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return 1
+`
+
+// revokeNodeTokenScript атомарно отзывает текущий токен ноды. Возвращает 0, если токена не было.
+//
+// KEYS[1]: nodeTokensKey, KEYS[2]: nodeTokenByNodeKey
+// ARGV[1]: идентификатор ноды
+const revokeNodeTokenScript = `
+local hash = redis.call('HGET', KEYS[2], ARGV[1])
+if not hash then
+    return 0
+end
+redis.call('HDEL', KEYS[1], hash)
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`
+
+var (
+	issueNodeToken  = redis.NewScript(issueNodeTokenScript)
+	revokeNodeToken = redis.NewScript(revokeNodeTokenScript)
+)
+
+// NodeTokenStore определяет интерфейс хранения токенов, которыми ноды подтверждают отправку логов.
+type NodeTokenStore interface {
+	IssueNodeToken(ctx context.Context, nodeID string) (string, error)
+	RevokeNodeToken(ctx context.Context, nodeID string) (bool, error)
+	AuthenticateNodeToken(ctx context.Context, token string) (string, bool, error)
+	ListNodeCredentials(ctx context.Context) ([]models.NodeCredential, error)
+}
+
+// hashNodeToken возвращает хеш токена, под которым он хранится в Redis.
+// Токены случайны и длинны, поэтому медленная функция хеширования не нужна.
+func hashNodeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueNodeToken выпускает новый токен для ноды. Предыдущий токен ноды, если был, сразу отзывается.
+// Токен возвращается только один раз: в Redis сохраняется лишь его хеш.
+func (s *RedisStore) IssueNodeToken(ctx context.Context, nodeID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена ноды: %w", err)
+	}
+	token := nodeTokenPrefix + hex.EncodeToString(buf)
+	hash := hashNodeToken(token)
+
+	credential, err := json.Marshal(models.NodeCredential{NodeID: nodeID, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации токена ноды: %w", err)
+	}
+
+	err = issueNodeToken.Run(ctx, s.client, []string{nodeTokensKey, nodeTokenByNodeKey}, nodeID, hash, credential).Err()
+	if err != nil {
+		return "", fmt.Errorf("ошибка сохранения токена ноды: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeNodeToken отзывает токен ноды. Возвращает false, если у ноды не было токена.
+func (s *RedisStore) RevokeNodeToken(ctx context.Context, nodeID string) (bool, error) {
+	revoked, err := revokeNodeToken.Run(ctx, s.client, []string{nodeTokensKey, nodeTokenByNodeKey}, nodeID).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка отзыва токена ноды: %w", err)
+	}
+	return revoked == 1, nil
+}
+
+// AuthenticateNodeToken возвращает идентификатор ноды, которой выдан токен.
+// Для неизвестного или отозванного токена возвращается ok == false без ошибки.
+func (s *RedisStore) AuthenticateNodeToken(ctx context.Context, token string) (string, bool, error) {
+	raw, err := s.client.HGet(ctx, nodeTokensKey, hashNodeToken(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка проверки токена ноды: %w", err)
+	}
+
+	var credential models.NodeCredential
+	if err := json.Unmarshal([]byte(raw), &credential); err != nil {
+		return "", false, fmt.Errorf("поврежденная запись токена ноды: %w", err)
+	}
+	return credential.NodeID, true, nil
+}
+
+// ListNodeCredentials возвращает ноды с действующими токенами, отсортированные по идентификатору.
+func (s *RedisStore) ListNodeCredentials(ctx context.Context) ([]models.NodeCredential, error) {
+	values, err := s.client.HVals(ctx, nodeTokensKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения токенов нод: %w", err)
+	}
+
+	credentials := make([]models.NodeCredential, 0, len(values))
+	for _, raw := range values {
+		var credential models.NodeCredential
+		if err := json.Unmarshal([]byte(raw), &credential); err != nil {
+			continue
+		}
+		credentials = append(credentials, credential)
+	}
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].NodeID < credentials[j].NodeID })
+	return credentials, nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"observer_service/internal/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// outboxPendingKey — список сообщений о блокировке, ожидающих публикации.
+	outboxPendingKey = "block_outbox:pending"
+	// outboxProcessingKey — сообщения, взятые на публикацию, но еще не подтвержденные брокером.
+	// Хеш-тег помещает ключ в слот outboxPendingKey: сообщения переносятся между списками атомарно.
+	outboxProcessingKey = "{block_outbox:pending}:processing"
+	// outboxLeasesKey — аренды обрабатываемых сообщений: сообщение -> срок аренды (unix ms).
+	outboxLeasesKey = "{block_outbox:pending}:leases"
+)
+
+// requeueOutboxScript возвращает в очередь обрабатываемые сообщения с истекшей арендой.
+// Сообщению без аренды (экземпляр упал между BLMOVE и ZADD или запущен до появления аренд)
+// назначается новая аренда: если его никто не подтвердит, оно вернется в очередь позже.
+// Сообщения с действующей арендой принадлежат работающим экземплярам и не трогаются.
+//
+// KEYS[1]: outboxPendingKey, KEYS[2]: outboxProcessingKey, KEYS[3]: outboxLeasesKey
+// ARGV[1]: текущее время (unix ms), ARGV[2]: срок аренды для сообщений без нее (unix ms)
+const requeueOutboxScript = `
+local items = redis.call('LRANGE', KEYS[2], 0, -1)
+local moved = 0
+for _, raw in ipairs(items) do
+    local deadline = redis.call('ZSCORE', KEYS[3], raw)
+    if not deadline then
+        redis.call('ZADD', KEYS[3], ARGV[2], raw)
+    elseif tonumber(deadline) <= tonumber(ARGV[1]) then
+        redis.call('LREM', KEYS[2], 1, raw)
+        redis.call('ZREM', KEYS[3], raw)
+        redis.call('RPUSH', KEYS[1], raw)
+        moved = moved + 1
+    end
+end
+return moved
+`
+
+var requeueOutbox = redis.NewScript(requeueOutboxScript)
+
+// OutboxEntry — сообщение о блокировке, взятое из outbox на публикацию.
+type OutboxEntry struct {
+	Message models.BlockMessage
+	raw     string
+}
+
+// OutboxStore определяет интерфейс персистентной очереди сообщений о блокировке
+// между обнаружением нарушения и публикацией в брокер.
+type OutboxStore interface {
+	EnqueueOutbox(ctx context.Context, msg models.BlockMessage) error
+	ClaimOutbox(ctx context.Context, wait, lease time.Duration) (*OutboxEntry, error)
+	RenewOutbox(ctx context.Context, entry *OutboxEntry, lease time.Duration) error
+	AckOutbox(ctx context.Context, entry *OutboxEntry) error
+	RequeueOutbox(ctx context.Context, lease time.Duration) (int, error)
+	OutboxLen(ctx context.Context) (int64, error)
+}
+
+// EnqueueOutbox добавляет сообщение о блокировке в outbox.
+func (s *RedisStore) EnqueueOutbox(ctx context.Context, msg models.BlockMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации сообщения для outbox: %w", err)
+	}
+	if err := s.client.LPush(ctx, outboxPendingKey, body).Err(); err != nil {
+		return fmt.Errorf("ошибка записи сообщения в outbox: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutbox атомарно переносит самое старое сообщение в список обрабатываемых и берет его
+// в аренду на lease. Ждет появления сообщения не дольше wait; если очередь пуста, возвращает nil без ошибки.
+func (s *RedisStore) ClaimOutbox(ctx context.Context, wait, lease time.Duration) (*OutboxEntry, error) {
+	raw, err := s.client.BLMove(ctx, outboxPendingKey, outboxProcessingKey, "RIGHT", "LEFT", wait).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения сообщения из outbox: %w", err)
+	}
+
+	entry := &OutboxEntry{raw: raw}
+	if err := json.Unmarshal([]byte(raw), &entry.Message); err != nil {
+		// Поврежденную запись удаляем, чтобы она не блокировала очередь.
+		_ = s.client.LRem(ctx, outboxProcessingKey, 1, raw).Err()
+		return nil, fmt.Errorf("поврежденная запись outbox удалена: %w", err)
+	}
+	if err := s.RenewOutbox(ctx, entry, lease); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// RenewOutbox продлевает аренду сообщения на lease от текущего момента. Издатель продлевает
+// аренду перед каждой попыткой публикации, чтобы другие экземпляры не забрали сообщение.
+func (s *RedisStore) RenewOutbox(ctx context.Context, entry *OutboxEntry, lease time.Duration) error {
+	deadline := float64(time.Now().Add(lease).UnixMilli())
+	if err := s.client.ZAdd(ctx, outboxLeasesKey, redis.Z{Score: deadline, Member: entry.raw}).Err(); err != nil {
+		return fmt.Errorf("ошибка продления аренды сообщения outbox: %w", err)
+	}
+	return nil
+}
+
+// AckOutbox удаляет опубликованное сообщение из списка обрабатываемых вместе с его арендой.
+func (s *RedisStore) AckOutbox(ctx context.Context, entry *OutboxEntry) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, outboxProcessingKey, 1, entry.raw)
+		pipe.ZRem(ctx, outboxLeasesKey, entry.raw)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка подтверждения сообщения outbox: %w", err)
+	}
+	return nil
+}
+
+// RequeueOutbox возвращает в очередь сообщения, аренда которых истекла (экземпляр, взявший их,
+// упал или остановился), и возвращает их количество. Сообщения, которые публикуют другие
+// работающие экземпляры, остаются у них. Сообщения без аренды получают аренду на lease.
+func (s *RedisStore) RequeueOutbox(ctx context.Context, lease time.Duration) (int, error) {
+	now := time.Now()
+	moved, err := requeueOutbox.Run(ctx, s.client, []string{outboxPendingKey, outboxProcessingKey, outboxLeasesKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка возврата сообщений в outbox: %w", err)
+	}
+	return moved, nil
+}
+
+// OutboxLen возвращает число сообщений, ожидающих публикации.
+func (s *RedisStore) OutboxLen(ctx context.Context) (int64, error) {
+	return s.client.LLen(ctx, outboxPendingKey).Result()
+}
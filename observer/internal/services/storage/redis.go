@@ -6,7 +6,6 @@ import (
 	"log"
 	"observer_service/internal/models"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -16,6 +15,8 @@ import (
 // Он получает все IP из множества пользователя, формирует список всех связанных ключей
 // (само множество и ключи TTL для каждого IP) и удаляет их одной командой DEL.
 // Это гарантирует, что никакие новые IP не "просочатся" между чтением и удалением.
+// Ключи TTL заранее неизвестны и не передаются в KEYS, но благодаря хеш-тегу {email}
+// в Redis Cluster они находятся в том же слоте, что и множество.
 //
 // KEYS[1]: ключ множества IP пользователя
 // ARGV[1]: префикс для ключей TTL
@@ -33,74 +34,169 @@ return redis.call('DEL', unpack(keysToDelete))
 // IPStorage определяет интерфейс для работы с хранилищем IP-адресов.
 type IPStorage interface {
 	CheckAndAddIP(ctx context.Context, email, ip string, limit int, ttl, cooldown time.Duration) (*models.CheckResult, error)
+	CheckAndAddIPs(ctx context.Context, requests []models.CheckRequest, ttl, cooldown time.Duration) []models.CheckResult
 	ClearUserIPs(ctx context.Context, email string) (int, error)
 	GetUserActiveIPs(ctx context.Context, userEmail string) (map[string]int, error)
-	GetAllUserEmails(ctx context.Context) ([]string, error)
+	// ListActiveUsers возвращает страницу индекса активных пользователей (примерно count записей)
+	// и курсор следующей страницы; пустой курсор — начало и конец обхода. Пользователь,
+	// остающийся в индексе на протяжении обхода, возвращается хотя бы один раз.
+	ListActiveUsers(ctx context.Context, cursor string, count int) ([]models.ActiveUser, string, error)
+	// PruneInactiveUsers снимает с индекса пользователей, не проявлявших активности с before.
+	PruneInactiveUsers(ctx context.Context, before time.Time) (int, error)
 	HasAlertCooldown(ctx context.Context, userEmail string) (bool, error)
 	Ping(ctx context.Context) error
 	Close() error
 }
 
-// RedisStore реализует IPStorage с использованием Redis.
+// Ключи пользователя содержат хеш-тег {email}: в Redis Cluster все они попадают в один слот,
+// поэтому Lua-скрипты, работающие с несколькими ключами пользователя, выполнимы и в кластере.
+func userIPsKey(email string) string       { return "user_ips:{" + email + "}" }
+func alertCooldownKey(email string) string { return "alert_sent:{" + email + "}" }
+func ipTTLPrefix(email string) string      { return "ip_ttl:{" + email + "}" }
+func ipTTLKey(email, ip string) string     { return ipTTLPrefix(email) + ":" + ip }
+
+// RedisStore реализует IPStorage с использованием Redis (отдельный сервер, Sentinel или Cluster).
 type RedisStore struct {
-	client            *redis.Client
-	addCheckScriptSHA string
-	clearScriptSHA    string
+	client         redis.UniversalClient
+	addCheckScript *redis.Script
+	clearScript    *redis.Script
 }
 
-// NewRedisStore создает новый экземпляр RedisStore.
-func NewRedisStore(ctx context.Context, redisURL, scriptPath string) (*RedisStore, error) {
-	opt, err := redis.ParseURL(redisURL)
+// NewRedisStore создает новый экземпляр RedisStore. mode — режим Redis (см. NewRedisClient).
+func NewRedisStore(ctx context.Context, mode, redisURL, scriptPath string) (*RedisStore, error) {
+	client, err := NewRedisClient(mode, redisURL)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка парсинга Redis URL: %w", err)
+		return nil, err
 	}
-	client := redis.NewClient(opt)
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("ошибка подключения к Redis: %w", err)
 	}
 
 	// Загрузка скрипта проверки и добавления IP из файла
-	addCheckScript, err := os.ReadFile(scriptPath)
+	addCheckSource, err := os.ReadFile(scriptPath)
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("ошибка чтения Lua-скрипта '%s': %w", scriptPath, err)
 	}
-	addCheckScriptSHA, err := client.ScriptLoad(ctx, string(addCheckScript)).Result()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка загрузки Lua-скрипта (add/check) в Redis: %w", err)
+	store := &RedisStore{
+		client:         client,
+		addCheckScript: redis.NewScript(string(addCheckSource)),
+		clearScript:    redis.NewScript(clearUserIPsScript),
 	}
 
-	// Загрузка скрипта атомарной очистки из константы
-	clearScriptSHA, err := client.ScriptLoad(ctx, clearUserIPsScript).Result()
-	if err != nil {
+	// Скрипты загружаются заранее (в кластере — на все мастеры). Если после переключения мастера
+	// скрипта на сервере не окажется, он будет передан заново (см. runCheckScripts).
+	if err := store.addCheckScript.Load(ctx, client).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ошибка загрузки Lua-скрипта (add/check) в Redis: %w", err)
+	}
+	if err := store.clearScript.Load(ctx, client).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("ошибка загрузки Lua-скрипта (clear) в Redis: %w", err)
 	}
 
-	log.Println("Успешное подключение к Redis и загрузка Lua-скриптов.")
-	return &RedisStore{
-		client:            client,
-		addCheckScriptSHA: addCheckScriptSHA,
-		clearScriptSHA:    clearScriptSHA,
-	}, nil
+	if err := store.migrateLegacyKeys(ctx); err != nil {
+		log.Printf("Warning: не удалось перенести ключи Redis в новую схему имен: %v", err)
+	}
+	if err := store.rebuildActiveUsers(ctx); err != nil {
+		log.Printf("Warning: не удалось построить индекс активных пользователей: %v", err)
+	}
+
+	log.Printf("Успешное подключение к Redis (режим: %s) и загрузка Lua-скриптов.", mode)
+	return store, nil
 }
 
 // CheckAndAddIP выполняет Lua-скрипт для атомарной проверки и добавления IP.
 func (s *RedisStore) CheckAndAddIP(ctx context.Context, email, ip string, limit int, ttl, cooldown time.Duration) (*models.CheckResult, error) {
-	userIPsSetKey := fmt.Sprintf("user_ips:%s", email)
-	alertSentKey := fmt.Sprintf("alert_sent:%s", email)
+	results := s.CheckAndAddIPs(ctx, []models.CheckRequest{{Email: email, IP: ip, Limit: limit}}, ttl, cooldown)
+	if err := results[0].Err; err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// CheckAndAddIPs выполняет проверки пачки записей одним конвейером (pipeline) вместо
+// отдельного обращения к Redis на каждую запись. Скрипты выполняются в порядке запросов,
+// поэтому результат тот же, что при последовательных вызовах CheckAndAddIP.
+// Ошибка отдельной записи возвращается в поле Err ее результата.
+// В Redis Cluster конвейер разбивается по узлам; записи одного пользователя попадают
+// на один узел и выполняются в исходном порядке.
+func (s *RedisStore) CheckAndAddIPs(ctx context.Context, requests []models.CheckRequest, ttl, cooldown time.Duration) []models.CheckResult {
+	results := make([]models.CheckResult, len(requests))
+	if len(requests) == 0 {
+		return results
+	}
+
+	cmds := s.runCheckScripts(ctx, requests, ttl, cooldown)
+	for i, cmd := range cmds {
+		email := requests[i].Email
+		raw, err := cmd.Result()
+		if err != nil {
+			results[i].Err = fmt.Errorf("ошибка выполнения Lua-скрипта для %s: %w", email, err)
+			continue
+		}
+		res, err := parseCheckResult(email, raw)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i] = *res
+	}
+	return results
+}
 
+// runCheckScripts выполняет скрипт проверки для каждого запроса одним конвейером
+// и в том же конвейере обновляет индекс активных пользователей.
+// Если на сервере нет скрипта (NOSCRIPT: например, после переключения мастера Sentinel
+// или перезапуска узла кластера), не выполненные из-за этого запросы повторяются
+// с передачей текста скрипта; остальные команды уже выполнены и не повторяются.
+func (s *RedisStore) runCheckScripts(ctx context.Context, requests []models.CheckRequest, ttl, cooldown time.Duration) []*redis.Cmd {
+	cmds := make([]*redis.Cmd, len(requests))
+	pipe := s.client.Pipeline()
+	for i, req := range requests {
+		keys, args := checkScriptParams(req.Email, req.IP, req.Limit, ttl, cooldown)
+		cmds[i] = s.addCheckScript.EvalSha(ctx, pipe, keys, args...)
+	}
+	touchActiveUsers(ctx, pipe, requests)
+	// Ошибка Exec дублирует ошибку первой неудачной команды, поэтому ошибки разбираются по командам.
+	_, _ = pipe.Exec(ctx)
+
+	var retry []int
+	for i, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			retry = append(retry, i)
+		}
+	}
+	if len(retry) == 0 {
+		return cmds
+	}
+
+	pipe = s.client.Pipeline()
+	for _, i := range retry {
+		req := requests[i]
+		keys, args := checkScriptParams(req.Email, req.IP, req.Limit, ttl, cooldown)
+		cmds[i] = s.addCheckScript.Eval(ctx, pipe, keys, args...)
+	}
+	_, _ = pipe.Exec(ctx)
+	return cmds
+}
+
+// checkScriptParams формирует ключи и аргументы скрипта add_and_check_ip.lua.
+func checkScriptParams(email, ip string, limit int, ttl, cooldown time.Duration) ([]string, []interface{}) {
+	keys := []string{userIPsKey(email), alertCooldownKey(email), ipTTLKey(email, ip)}
 	args := []interface{}{
 		ip,
 		int(ttl.Seconds()),
 		limit,
 		int(cooldown.Seconds()),
 	}
+	return keys, args
+}
 
-	result, err := s.client.EvalSha(ctx, s.addCheckScriptSHA, []string{userIPsSetKey, alertSentKey}, args...).Result()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка выполнения Lua-скрипта для %s: %w", email, err)
-	}
-
+// parseCheckResult разбирает ответ скрипта add_and_check_ip.lua.
+func parseCheckResult(email string, result interface{}) (*models.CheckResult, error) {
 	resSlice, ok := result.([]interface{})
 	if !ok || len(resSlice) < 1 {
 		return nil, fmt.Errorf("неожиданный результат от Lua-скрипта для %s", email)
@@ -131,11 +227,8 @@ func (s *RedisStore) CheckAndAddIP(ctx context.Context, email, ip string, limit
 
 // ClearUserIPs атомарно удаляет все ключи, связанные с пользователем, используя Lua-скрипт.
 func (s *RedisStore) ClearUserIPs(ctx context.Context, email string) (int, error) {
-	userIpsKey := fmt.Sprintf("user_ips:%s", email)
-	ipTtlPrefix := fmt.Sprintf("ip_ttl:%s", email)
-
 	// Выполняем Lua-скрипт, который атомарно получает список IP и удаляет все связанные ключи.
-	deleted, err := s.client.EvalSha(ctx, s.clearScriptSHA, []string{userIpsKey}, ipTtlPrefix).Int64()
+	deleted, err := s.clearScript.Run(ctx, s.client, []string{userIPsKey(email)}, ipTTLPrefix(email)).Int64()
 	if err != nil {
 		// Скрипт DEL не должен возвращать redis.Nil, но на всякий случай проверяем.
 		if err == redis.Nil {
@@ -143,14 +236,17 @@ func (s *RedisStore) ClearUserIPs(ctx context.Context, email string) (int, error
 		}
 		return 0, fmt.Errorf("ошибка выполнения Lua-скрипта (clear) для %s: %w", email, err)
 	}
+	// Индекс находится в другом слоте кластера, поэтому обновляется отдельной командой.
+	if err := s.client.ZRem(ctx, activeUsersKey, email).Err(); err != nil {
+		return int(deleted), fmt.Errorf("ошибка удаления %s из индекса активных пользователей: %w", email, err)
+	}
 
 	return int(deleted), nil
 }
 
 // GetUserActiveIPs возвращает активные IP пользователя с их TTL.
 func (s *RedisStore) GetUserActiveIPs(ctx context.Context, userEmail string) (map[string]int, error) {
-	userIpsKey := fmt.Sprintf("user_ips:%s", userEmail)
-	ips, err := s.client.SMembers(ctx, userIpsKey).Result()
+	ips, err := s.client.SMembers(ctx, userIPsKey(userEmail)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -163,8 +259,7 @@ func (s *RedisStore) GetUserActiveIPs(ctx context.Context, userEmail string) (ma
 	ttlResults := make(map[string]*redis.DurationCmd)
 
 	for _, ip := range ips {
-		ipTtlKey := fmt.Sprintf("ip_ttl:%s:%s", userEmail, ip)
-		ttlResults[ip] = pipe.TTL(ctx, ipTtlKey)
+		ttlResults[ip] = pipe.TTL(ctx, ipTTLKey(userEmail, ip))
 	}
 	_, err = pipe.Exec(ctx)
 	if err != nil && err != redis.Nil {
@@ -181,34 +276,9 @@ func (s *RedisStore) GetUserActiveIPs(ctx context.Context, userEmail string) (ma
 	return activeIPs, nil
 }
 
-// GetAllUserEmails сканирует ключи Redis для получения всех username (email) пользователей.
-func (s *RedisStore) GetAllUserEmails(ctx context.Context) ([]string, error) {
-	var cursor uint64
-	var emails []string
-	for {
-		var keys []string
-		var err error
-		keys, cursor, err = s.client.Scan(ctx, cursor, "user_ips:*", 500).Result()
-		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании ключей (SCAN): %w", err)
-		}
-		for _, key := range keys {
-			parts := strings.SplitN(key, ":", 2)
-			if len(parts) == 2 {
-				emails = append(emails, parts[1])
-			}
-		}
-		if cursor == 0 {
-			break
-		}
-	}
-	return emails, nil
-}
-
 // HasAlertCooldown проверяет наличие ключа кулдауна для пользователя.
 func (s *RedisStore) HasAlertCooldown(ctx context.Context, userEmail string) (bool, error) {
-	alertCooldownKey := fmt.Sprintf("alert_sent:%s", userEmail)
-	res, err := s.client.Exists(ctx, alertCooldownKey).Result()
+	res, err := s.client.Exists(ctx, alertCooldownKey(userEmail)).Result()
 	if err != nil {
 		return false, err
 	}
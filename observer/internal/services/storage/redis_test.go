@@ -0,0 +1,28 @@
+package storage_test
+
+import (
+	"observer_service/internal/services/storage"
+	"observer_service/internal/services/storage/storagetest"
+	"os"
+	"testing"
+)
+
+// TestRedisStore прогоняет общие проверки на настоящем Redis, адрес которого задан
+// в OBSERVER_TEST_REDIS_URL (например, redis://localhost:6379/15). Без переменной тест пропускается.
+func TestRedisStore(t *testing.T) {
+	redisURL := os.Getenv("OBSERVER_TEST_REDIS_URL")
+	if redisURL == "" {
+		t.Skip("OBSERVER_TEST_REDIS_URL не задан")
+	}
+	mode := os.Getenv("OBSERVER_TEST_REDIS_MODE")
+	if mode == "" {
+		mode = "single"
+	}
+
+	store, err := storage.NewRedisStore(t.Context(), mode, redisURL, "../../scripts/add_and_check_ip.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	storagetest.TestIPStorage(t, store)
+}
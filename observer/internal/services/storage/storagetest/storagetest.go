@@ -0,0 +1,302 @@
+// Package storagetest содержит общий набор проверок реализаций storage.IPStorage.
+// Все реализации (RedisStore, MemoryStore, BoltStore) обязаны его проходить, поэтому
+// LogProcessor и PoolMonitor ведут себя одинаково независимо от хранилища.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"observer_service/internal/models"
+	"observer_service/internal/services/storage"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// ttl и cooldown в проверках: достаточно долгие, чтобы не истечь посреди проверки.
+	ttl      = time.Hour
+	cooldown = time.Hour
+	// shortTTL используется в проверке истечения; Redis хранит TTL с точностью до секунды.
+	shortTTL = time.Second
+)
+
+// TestIPStorage проверяет, что store соблюдает семантику IPStorage: коды 0/1/2, IsNewIP,
+// кулдаун алертов, пакетную проверку, очистку, индекс активных пользователей и истечение TTL.
+// Каждая группа проверок выполняется отдельным подтестом.
+//
+// Проверки используют собственных пользователей с уникальным префиксом и не трогают
+// чужие данные, поэтому их можно запускать на общем Redis. Проверка истечения TTL ждет
+// около двух секунд.
+func TestIPStorage(t *testing.T, store storage.IPStorage) {
+	s := &suite{store: store, prefix: "storagetest-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-"}
+
+	// Пользователи проверок удаляются; оставшиеся кулдауны истекут сами.
+	t.Cleanup(func() {
+		for _, email := range s.users {
+			if _, err := store.ClearUserIPs(context.Background(), email); err != nil {
+				t.Errorf("ClearUserIPs(%s): %v", email, err)
+			}
+		}
+	})
+
+	t.Run("Ping", s.testPing)
+	t.Run("LimitStatuses", s.testLimitStatuses)
+	t.Run("Batch", s.testBatch)
+	t.Run("Clear", s.testClear)
+	t.Run("ActiveUsers", s.testActiveUsers)
+	t.Run("Expiry", s.testExpiry)
+}
+
+type suite struct {
+	store  storage.IPStorage
+	prefix string
+
+	mu    sync.Mutex
+	users []string
+}
+
+// user возвращает новый уникальный идентификатор пользователя.
+func (s *suite) user(name string) string {
+	email := s.prefix + name + "@example.com"
+	s.mu.Lock()
+	s.users = append(s.users, email)
+	s.mu.Unlock()
+	return email
+}
+
+// expect сравнивает результат проверки с ожидаемыми кодом, числом IP и признаком нового IP.
+func expect(t *testing.T, step string, res *models.CheckResult, status, count int64, isNew bool) {
+	t.Helper()
+	if res.StatusCode != status || res.CurrentIPCount != count || res.IsNewIP != isNew {
+		t.Errorf("%s: получено {status=%d count=%d new=%v}, ожидалось {status=%d count=%d new=%v}",
+			step, res.StatusCode, res.CurrentIPCount, res.IsNewIP, status, count, isNew)
+	}
+}
+
+func (s *suite) check(t *testing.T, email, ip string, limit int, d time.Duration) *models.CheckResult {
+	t.Helper()
+	res, err := s.store.CheckAndAddIP(t.Context(), email, ip, limit, d, d)
+	if err != nil {
+		t.Errorf("CheckAndAddIP(%s, %s): %v", email, ip, err)
+		return &models.CheckResult{StatusCode: -1}
+	}
+	return res
+}
+
+// listUsers обходит индекс активных пользователей маленькими страницами.
+func (s *suite) listUsers(t *testing.T) map[string]models.ActiveUser {
+	t.Helper()
+	users := make(map[string]models.ActiveUser)
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > 100000 {
+			t.Error("ListActiveUsers не завершает обход")
+			return users
+		}
+		list, next, err := s.store.ListActiveUsers(t.Context(), cursor, 2)
+		if err != nil {
+			t.Errorf("ListActiveUsers: %v", err)
+			return users
+		}
+		for _, user := range list {
+			users[user.Email] = user
+		}
+		if next == "" {
+			return users
+		}
+		cursor = next
+	}
+}
+
+func (s *suite) hasUser(t *testing.T, email string) bool {
+	t.Helper()
+	_, ok := s.listUsers(t)[email]
+	return ok
+}
+
+func (s *suite) cooldown(t *testing.T, email string) bool {
+	t.Helper()
+	has, err := s.store.HasAlertCooldown(t.Context(), email)
+	if err != nil {
+		t.Errorf("HasAlertCooldown(%s): %v", email, err)
+	}
+	return has
+}
+
+func (s *suite) activeIPs(t *testing.T, email string) map[string]int {
+	t.Helper()
+	active, err := s.store.GetUserActiveIPs(t.Context(), email)
+	if err != nil {
+		t.Errorf("GetUserActiveIPs(%s): %v", email, err)
+	}
+	return active
+}
+
+func (s *suite) testPing(t *testing.T) {
+	if err := s.store.Ping(t.Context()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
+
+// testLimitStatuses проходит путь пользователя от первого IP до превышения лимита и кулдауна.
+func (s *suite) testLimitStatuses(t *testing.T) {
+	email := s.user("limit")
+	if s.hasUser(t, email) || s.cooldown(t, email) || len(s.activeIPs(t, email)) != 0 {
+		t.Error("новый пользователь не должен иметь IP и кулдауна")
+	}
+
+	expect(t, "первый IP", s.check(t, email, "10.0.0.1", 2, ttl), 0, 1, true)
+	expect(t, "повтор IP", s.check(t, email, "10.0.0.1", 2, ttl), 0, 1, false)
+	expect(t, "второй IP", s.check(t, email, "10.0.0.2", 2, ttl), 0, 2, true)
+	if s.cooldown(t, email) {
+		t.Error("кулдаун не должен появляться до превышения лимита")
+	}
+
+	res := s.check(t, email, "10.0.0.3", 2, ttl)
+	expect(t, "превышение лимита", res, 1, 3, false)
+	ips := append([]string(nil), res.AllUserIPs...)
+	sort.Strings(ips)
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("превышение лимита: AllUserIPs=%v, ожидалось %v", ips, want)
+	}
+	if !s.cooldown(t, email) {
+		t.Error("после превышения лимита должен действовать кулдаун")
+	}
+
+	expect(t, "превышение на кулдауне", s.check(t, email, "10.0.0.4", 2, ttl), 2, 4, false)
+	expect(t, "известный IP на кулдауне", s.check(t, email, "10.0.0.1", 2, ttl), 2, 4, false)
+
+	user, ok := s.listUsers(t)[email]
+	if !ok {
+		t.Error("ListActiveUsers не вернул пользователя с IP")
+	} else if age := time.Since(user.LastSeen); age < -time.Minute || age > time.Minute {
+		t.Errorf("LastSeen пользователя %v, ожидалось около текущего времени", user.LastSeen)
+	}
+	active := s.activeIPs(t, email)
+	if len(active) != 4 {
+		t.Errorf("GetUserActiveIPs вернул %d IP, ожидалось 4: %v", len(active), active)
+	}
+	for ip, left := range active {
+		if left <= 0 || left > int(ttl.Seconds()) {
+			t.Errorf("TTL IP %s = %d, ожидалось в (0, %d]", ip, left, int(ttl.Seconds()))
+		}
+	}
+}
+
+// testBatch проверяет, что пакетная проверка эквивалентна последовательным вызовам.
+func (s *suite) testBatch(t *testing.T) {
+	a, b := s.user("batch-a"), s.user("batch-b")
+	requests := []models.CheckRequest{
+		{Email: a, IP: "10.1.0.1", Limit: 2},
+		{Email: b, IP: "10.2.0.1", Limit: 1},
+		{Email: a, IP: "10.1.0.1", Limit: 2},
+		{Email: a, IP: "10.1.0.2", Limit: 2},
+		{Email: b, IP: "10.2.0.2", Limit: 1},
+		{Email: a, IP: "10.1.0.3", Limit: 2},
+		{Email: b, IP: "10.2.0.3", Limit: 1},
+	}
+	want := []struct {
+		status, count int64
+		isNew         bool
+	}{
+		{0, 1, true}, {0, 1, true}, {0, 1, false}, {0, 2, true}, {1, 2, false}, {1, 3, false}, {2, 3, false},
+	}
+
+	results := s.store.CheckAndAddIPs(t.Context(), requests, ttl, cooldown)
+	if len(results) != len(requests) {
+		t.Errorf("CheckAndAddIPs вернул %d результатов на %d запросов", len(results), len(requests))
+		return
+	}
+	for i := range results {
+		if results[i].Err != nil {
+			t.Errorf("запись %d: %v", i, results[i].Err)
+			continue
+		}
+		expect(t, fmt.Sprintf("запись %d", i), &results[i], want[i].status, want[i].count, want[i].isNew)
+	}
+
+	if empty := s.store.CheckAndAddIPs(t.Context(), nil, ttl, cooldown); len(empty) != 0 {
+		t.Errorf("пустая пачка вернула %d результатов", len(empty))
+	}
+}
+
+// testClear проверяет очистку IP: число удаленных ключей, сохранение кулдауна и повторный отсчет лимита.
+func (s *suite) testClear(t *testing.T) {
+	email := s.user("clear")
+	s.check(t, email, "10.3.0.1", 1, ttl)
+	s.check(t, email, "10.3.0.2", 1, ttl) // Превышение: появляется кулдаун
+
+	// Как в Redis: множество IP плюс ключ TTL каждого IP.
+	cleared, err := s.store.ClearUserIPs(t.Context(), email)
+	if err != nil {
+		t.Errorf("ClearUserIPs: %v", err)
+	} else if cleared != 3 {
+		t.Errorf("ClearUserIPs вернул %d, ожидалось 3", cleared)
+	}
+	if s.hasUser(t, email) || len(s.activeIPs(t, email)) != 0 {
+		t.Error("после очистки у пользователя не должно оставаться IP")
+	}
+	if !s.cooldown(t, email) {
+		t.Error("очистка IP не должна снимать кулдаун")
+	}
+
+	if cleared, err := s.store.ClearUserIPs(t.Context(), email); err != nil || cleared != 0 {
+		t.Errorf("повторная очистка: %d, %v; ожидалось 0 без ошибки", cleared, err)
+	}
+	if cleared, err := s.store.ClearUserIPs(t.Context(), s.user("unknown")); err != nil || cleared != 0 {
+		t.Errorf("очистка неизвестного пользователя: %d, %v; ожидалось 0 без ошибки", cleared, err)
+	}
+
+	expect(t, "IP после очистки", s.check(t, email, "10.3.0.1", 1, ttl), 0, 1, true)
+	expect(t, "превышение после очистки на кулдауне", s.check(t, email, "10.3.0.3", 1, ttl), 2, 2, false)
+}
+
+// testActiveUsers проверяет постраничный обход индекса и снятие неактивных пользователей.
+func (s *suite) testActiveUsers(t *testing.T) {
+	var emails []string
+	for i := 0; i < 5; i++ {
+		email := s.user(fmt.Sprintf("active-%d", i))
+		s.check(t, email, "10.5.0.1", 1, ttl)
+		emails = append(emails, email)
+	}
+	listed := s.listUsers(t)
+	for _, email := range emails {
+		if _, ok := listed[email]; !ok {
+			t.Errorf("постраничный обход ListActiveUsers пропустил %s", email)
+		}
+	}
+
+	// Отсечка в далеком прошлом не снимает недавно активных пользователей. Отсечку ближе
+	// проверить нельзя: она сняла бы с индекса и реальных пользователей хранилища.
+	if _, err := s.store.PruneInactiveUsers(t.Context(), time.Unix(1, 0)); err != nil {
+		t.Errorf("PruneInactiveUsers: %v", err)
+	}
+	if !s.hasUser(t, emails[0]) {
+		t.Error("PruneInactiveUsers снял недавно активного пользователя")
+	}
+}
+
+// testExpiry проверяет истечение TTL IP, множества и кулдауна.
+func (s *suite) testExpiry(t *testing.T) {
+	email := s.user("expiry")
+	s.check(t, email, "10.4.0.1", 1, shortTTL)
+	expect(t, "превышение с коротким TTL", s.check(t, email, "10.4.0.2", 1, shortTTL), 1, 2, false)
+
+	time.Sleep(2*shortTTL + 100*time.Millisecond)
+
+	if len(s.activeIPs(t, email)) != 0 {
+		t.Error("после истечения TTL у пользователя не должно оставаться IP")
+	}
+	// Индекс не истекает сам: пользователь остается в нем до PruneInactiveUsers или очистки IP.
+	if !s.hasUser(t, email) {
+		t.Error("пользователь с истекшими IP должен оставаться в индексе до PruneInactiveUsers")
+	}
+	if s.cooldown(t, email) {
+		t.Error("кулдаун должен истечь")
+	}
+	expect(t, "IP после истечения", s.check(t, email, "10.4.0.2", 1, ttl), 0, 1, true)
+}
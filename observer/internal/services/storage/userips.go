@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"math"
+	"observer_service/internal/models"
+	"sort"
+	"time"
+)
+
+// userIPs — состояние пользователя для хранилищ без Redis (MemoryStore, BoltStore).
+// Повторяет модель ключей RedisStore и скрипта add_and_check_ip.lua:
+//   - множество IP (user_ips:<email>) живет до SetExpiresAt, который продлевается при каждом добавлении;
+//     IP с истекшим собственным TTL остаются в множестве и учитываются в лимите, пока живо множество;
+//   - собственный TTL каждого IP (ip_ttl:<email>:<ip>) хранится в IPs;
+//   - кулдаун алертов (alert_sent:<email>) не зависит от множества и переживает его очистку;
+//   - LastSeen — запись пользователя в индексе активных пользователей (active_users): обновляется
+//     при каждой проверке, снимается очисткой IP и PruneInactiveUsers, но не истекает сама.
+//
+// Все моменты времени — unix-время в миллисекундах.
+type userIPs struct {
+	SetExpiresAt      int64            `json:"set_expires_at,omitempty"`
+	IPs               map[string]int64 `json:"ips,omitempty"`
+	CooldownExpiresAt int64            `json:"cooldown_expires_at,omitempty"`
+	LastSeen          int64            `json:"last_seen,omitempty"`
+}
+
+// expire удаляет истекшие ключи. Возвращает true, если от пользователя ничего не осталось.
+func (u *userIPs) expire(now int64) bool {
+	if u.SetExpiresAt <= now {
+		u.SetExpiresAt = 0
+		u.IPs = nil
+	}
+	if u.CooldownExpiresAt <= now {
+		u.CooldownExpiresAt = 0
+	}
+	return u.SetExpiresAt == 0 && u.CooldownExpiresAt == 0 && u.LastSeen == 0
+}
+
+// check добавляет IP и проверяет лимит так же, как add_and_check_ip.lua.
+// TTL и кулдаун, как и в Redis (SETEX/EXPIRE), округляются вниз до целых секунд.
+func (u *userIPs) check(ip string, limit int, ttl, cooldown time.Duration, now int64) models.CheckResult {
+	u.expire(now)
+
+	ipExpiresAt := now + wholeSeconds(ttl)
+	if u.IPs == nil {
+		u.IPs = make(map[string]int64)
+	}
+	_, known := u.IPs[ip]
+	u.IPs[ip] = ipExpiresAt
+	u.SetExpiresAt = ipExpiresAt
+	u.LastSeen = now
+
+	count := int64(len(u.IPs))
+	if count <= int64(limit) {
+		return models.CheckResult{StatusCode: 0, CurrentIPCount: count, IsNewIP: !known}
+	}
+
+	if u.CooldownExpiresAt == 0 {
+		u.CooldownExpiresAt = now + wholeSeconds(cooldown)
+		all := make([]string, 0, len(u.IPs))
+		for member := range u.IPs {
+			all = append(all, member)
+		}
+		sort.Strings(all)
+		return models.CheckResult{StatusCode: 1, CurrentIPCount: int64(len(all)), AllUserIPs: all}
+	}
+	return models.CheckResult{StatusCode: 2, CurrentIPCount: count}
+}
+
+// clear удаляет множество и TTL всех его IP, оставляя кулдаун. Возвращает число удаленных
+// ключей в терминах Redis: множество плюс еще не истекшие ключи TTL его IP.
+func (u *userIPs) clear(now int64) int {
+	u.expire(now)
+	u.LastSeen = 0
+	if u.SetExpiresAt == 0 {
+		return 0
+	}
+	deleted := 1
+	for _, expiresAt := range u.IPs {
+		if expiresAt > now {
+			deleted++
+		}
+	}
+	u.SetExpiresAt = 0
+	u.IPs = nil
+	return deleted
+}
+
+// activeIPs возвращает IP с еще не истекшим TTL и оставшееся время в секундах,
+// округленное, как в команде TTL.
+func (u *userIPs) activeIPs(now int64) map[string]int {
+	u.expire(now)
+	active := make(map[string]int)
+	for ip, expiresAt := range u.IPs {
+		if ttl := int(math.Round(float64(expiresAt-now) / 1000)); ttl > 0 {
+			active[ip] = ttl
+		}
+	}
+	return active
+}
+
+// prune снимает пользователя с индекса активных, если он не проявлял активности с before.
+// Возвращает true, если запись снята.
+func (u *userIPs) prune(before int64) bool {
+	if u.LastSeen == 0 || u.LastSeen >= before {
+		return false
+	}
+	u.LastSeen = 0
+	return true
+}
+
+// activeUser возвращает запись индекса активных пользователей, если пользователь в нем есть.
+func (u *userIPs) activeUser(email string) (models.ActiveUser, bool) {
+	if u.LastSeen == 0 {
+		return models.ActiveUser{}, false
+	}
+	return models.ActiveUser{Email: email, LastSeen: time.UnixMilli(u.LastSeen)}, true
+}
+
+// hasCooldown сообщает, действует ли кулдаун алертов.
+func (u *userIPs) hasCooldown(now int64) bool {
+	return u.CooldownExpiresAt > now
+}
+
+func wholeSeconds(d time.Duration) int64 {
+	return int64(d/time.Second) * 1000
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
@@ -0,0 +1,137 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"observer_service/internal/models"
+	"observer_service/internal/services/storage"
+	"strings"
+	"time"
+)
+
+// BlockTracker агрегирует отчеты блокировщиков в состояние каждой блокировки.
+// Состояние хранится в Redis, поэтому все экземпляры observer видят одни и те же отчеты,
+// какой бы из них ни получил отчет из общей очереди результатов.
+type BlockTracker struct {
+	store         storage.BlockStatusStore
+	expectedNodes int
+	knownNodeTTL  time.Duration
+}
+
+// NewBlockTracker создает новый экземпляр BlockTracker.
+// expectedNodes задает ожидаемое число нод; 0 означает "по числу недавно отвечавших нод".
+func NewBlockTracker(store storage.BlockStatusStore, expectedNodes int, knownNodeTTL time.Duration) *BlockTracker {
+	return &BlockTracker{
+		store:         store,
+		expectedNodes: expectedNodes,
+		knownNodeTTL:  knownNodeTTL,
+	}
+}
+
+// Register регистрирует опубликованную блокировку, для которой ожидаются отчеты нод.
+func (t *BlockTracker) Register(ctx context.Context, msg models.BlockMessage, userIdentifier string) error {
+	return t.store.SaveBlockStatus(ctx, models.BlockStatus{
+		BlockID:        msg.BlockID,
+		UserIdentifier: userIdentifier,
+		IPs:            msg.IPs,
+		Duration:       msg.Duration,
+		PublishedAt:    time.Now(),
+	})
+}
+
+// Remove удаляет блокировку из отслеживания, например если ее не удалось опубликовать.
+func (t *BlockTracker) Remove(ctx context.Context, blockID string) error {
+	return t.store.DeleteBlockStatus(ctx, blockID)
+}
+
+// Record учитывает отчет ноды. Отчеты по неизвестным блокировкам только обновляют список нод.
+func (t *BlockTracker) Record(ctx context.Context, result models.BlockResult) error {
+	if result.NodeID == "" {
+		return nil
+	}
+	if err := t.store.TouchNode(ctx, result.NodeID, time.Now()); err != nil {
+		return err
+	}
+	_, err := t.store.RecordBlockResult(ctx, result)
+	return err
+}
+
+// Get возвращает текущее состояние блокировки по ее идентификатору.
+func (t *BlockTracker) Get(ctx context.Context, blockID string) (models.BlockStatus, bool, error) {
+	status, ok, err := t.store.GetBlockStatus(ctx, blockID)
+	if err != nil || !ok {
+		return models.BlockStatus{}, ok, err
+	}
+	expected, err := t.countKnownNodes(ctx)
+	if err != nil {
+		return models.BlockStatus{}, false, err
+	}
+	return snapshot(status, expected), true, nil
+}
+
+// Recent возвращает состояние последних limit блокировок, начиная с самых новых.
+func (t *BlockTracker) Recent(ctx context.Context, limit int) ([]models.BlockStatus, error) {
+	statuses, err := t.store.RecentBlockStatuses(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := t.countKnownNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statuses {
+		statuses[i] = snapshot(statuses[i], expected)
+	}
+	return statuses, nil
+}
+
+// snapshot пересчитывает счетчики и сводку состояния; expectedNodes — ожидаемое число нод.
+func snapshot(status models.BlockStatus, expectedNodes int) models.BlockStatus {
+	status.AppliedNodes, status.PartialNodes, status.FailedNodes = 0, 0, 0
+	for _, result := range status.Nodes {
+		switch {
+		case len(result.FailedIPs) == 0:
+			status.AppliedNodes++
+		case len(result.AppliedIPs) > 0:
+			status.PartialNodes++
+		default:
+			status.FailedNodes++
+		}
+	}
+
+	status.ExpectedNodes = expectedNodes
+	if status.ExpectedNodes < len(status.Nodes) {
+		status.ExpectedNodes = len(status.Nodes)
+	}
+	status.Summary = summarize(status)
+	return status
+}
+
+// countKnownNodes возвращает ожидаемое число нод с учетом конфигурации и недавних отчетов.
+func (t *BlockTracker) countKnownNodes(ctx context.Context) (int, error) {
+	nodes, err := t.NodeIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return max(t.expectedNodes, len(nodes)), nil
+}
+
+// summarize формирует человекочитаемую сводку, например "applied on 7/8 nodes".
+func summarize(status models.BlockStatus) string {
+	parts := []string{fmt.Sprintf("applied on %d/%d nodes", status.AppliedNodes, status.ExpectedNodes)}
+	if status.PartialNodes > 0 {
+		parts = append(parts, fmt.Sprintf("partial on %d", status.PartialNodes))
+	}
+	if status.FailedNodes > 0 {
+		parts = append(parts, fmt.Sprintf("failed on %d", status.FailedNodes))
+	}
+	if missing := status.ExpectedNodes - len(status.Nodes); missing > 0 {
+		parts = append(parts, fmt.Sprintf("no report from %d", missing))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NodeIDs возвращает отсортированный список нод, отчитывавшихся в пределах knownNodeTTL.
+func (t *BlockTracker) NodeIDs(ctx context.Context) ([]string, error) {
+	return t.store.ActiveNodes(ctx, time.Now().Add(-t.knownNodeTTL))
+}
@@ -0,0 +1,379 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"observer_service/internal/config"
+	"observer_service/internal/models"
+	"observer_service/internal/processor"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// flushInterval — как часто накопленные записи передаются в обработчик, даже если пачка не заполнена.
+	flushInterval = time.Second
+	// handshakeTimeout ограничивает TLS-рукопожатие, чтобы молчащий клиент не держал соединение.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Listener принимает access-логи Xray по syslog (RFC 5424 и RFC 3164) через UDP и TCP
+// (с необязательным TLS) и передает разобранные записи в LogProcessor.
+type Listener struct {
+	cfg       *config.Config
+	processor *processor.LogProcessor
+	allowed   []netip.Prefix
+	udpConn   net.PacketConn
+	tcpLn     net.Listener
+
+	mu    sync.Mutex
+	batch []models.LogEntry
+}
+
+// NewListener открывает сокеты syslog, заданные в SYSLOG_UDP_ADDR и SYSLOG_TCP_ADDR.
+// Если задан SYSLOG_TLS_CERT_FILE, TCP-порт принимает только TLS; с SYSLOG_TLS_CLIENT_CA_FILE
+// клиенты обязаны предъявить сертификат, подписанный этим CA.
+func NewListener(cfg *config.Config, proc *processor.LogProcessor) (*Listener, error) {
+	l := &Listener{cfg: cfg, processor: proc}
+
+	for _, item := range cfg.SyslogAllowedCIDRs {
+		prefix, err := parsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный адрес в SYSLOG_ALLOWED_CIDRS: %w", err)
+		}
+		l.allowed = append(l.allowed, prefix)
+	}
+
+	if cfg.SyslogTCPAddr != "" {
+		ln, err := net.Listen("tcp", cfg.SyslogTCPAddr)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось открыть TCP-порт syslog: %w", err)
+		}
+		if cfg.SyslogTLSCertFile != "" {
+			tlsConfig, err := newTLSConfig(cfg)
+			if err != nil {
+				ln.Close()
+				return nil, err
+			}
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+		l.tcpLn = ln
+	}
+
+	if cfg.SyslogUDPAddr != "" {
+		conn, err := net.ListenPacket("udp", cfg.SyslogUDPAddr)
+		if err != nil {
+			if l.tcpLn != nil {
+				l.tcpLn.Close()
+			}
+			return nil, fmt.Errorf("не удалось открыть UDP-порт syslog: %w", err)
+		}
+		l.udpConn = conn
+	}
+
+	return l, nil
+}
+
+// newTLSConfig загружает сертификат сервера и, если задан, CA для проверки клиентов.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.SyslogTLSCertFile, cfg.SyslogTLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить сертификат TLS для syslog: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if cfg.SyslogTLSClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.SyslogTLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать SYSLOG_TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("в SYSLOG_TLS_CLIENT_CA_FILE нет ни одного сертификата")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// parsePrefix разбирает подсеть или одиночный адрес.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Run принимает сообщения до отмены контекста. Перед выходом оставшиеся записи передаются в обработчик.
+func (l *Listener) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if len(l.allowed) == 0 {
+		log.Println("ВНИМАНИЕ: SYSLOG_ALLOWED_CIDRS не задан, syslog принимает записи от любых отправителей.")
+	}
+
+	var listenerWg sync.WaitGroup
+	if l.udpConn != nil {
+		log.Printf("Прием syslog по UDP на %s", l.udpConn.LocalAddr())
+		listenerWg.Add(1)
+		go l.serveUDP(ctx, &listenerWg)
+	}
+	if l.tcpLn != nil {
+		log.Printf("Прием syslog по TCP на %s (TLS: %v)", l.tcpLn.Addr(), l.cfg.SyslogTLSCertFile != "")
+		listenerWg.Add(1)
+		go l.serveTCP(ctx, &listenerWg)
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if l.udpConn != nil {
+				l.udpConn.Close()
+			}
+			if l.tcpLn != nil {
+				l.tcpLn.Close()
+			}
+			listenerWg.Wait()
+			l.flush()
+			log.Println("Прием syslog остановлен.")
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+func (l *Listener) serveUDP(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	buf := make([]byte, l.cfg.SyslogMaxMessageSize)
+	for {
+		n, addr, err := l.udpConn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Ошибка чтения syslog по UDP: %v", err)
+			continue
+		}
+		sender := addrOf(addr)
+		if !l.isAllowed(sender) {
+			continue
+		}
+		// Некоторые отправители кладут в одну датаграмму несколько строк.
+		for _, raw := range strings.Split(string(buf[:n]), "\n") {
+			if raw != "" {
+				l.handle(raw, sender, "")
+			}
+		}
+	}
+}
+
+func (l *Listener) serveTCP(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var connWg sync.WaitGroup
+	defer connWg.Wait()
+	for {
+		conn, err := l.tcpLn.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Ошибка приема соединения syslog: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		sender := addrOf(conn.RemoteAddr())
+		if !l.isAllowed(sender) {
+			log.Printf("Соединение syslog от %s отклонено: адрес не входит в SYSLOG_ALLOWED_CIDRS", sender)
+			conn.Close()
+			continue
+		}
+
+		connWg.Add(1)
+		go func() {
+			defer connWg.Done()
+			l.serveConn(ctx, conn, sender)
+		}()
+	}
+}
+
+// serveConn читает сообщения из TCP-соединения. Поддерживаются оба способа разделения
+// сообщений из RFC 6587: octet counting ("<длина> <сообщение>") и перевод строки.
+func (l *Listener) serveConn(ctx context.Context, conn net.Conn, sender netip.Addr) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	certNode := ""
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			log.Printf("Ошибка TLS-рукопожатия syslog с %s: %v", sender, err)
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			certNode = certs[0].Subject.CommonName
+		}
+	}
+	if l.cfg.IngestAuthRequired && certNode == "" {
+		log.Printf("Соединение syslog от %s отклонено: INGEST_AUTH_REQUIRED требует клиентский сертификат с CN ноды", sender)
+		return
+	}
+
+	reader := bufio.NewReaderSize(conn, l.cfg.SyslogMaxMessageSize)
+	for {
+		raw, err := l.readFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && ctx.Err() == nil {
+				log.Printf("Соединение syslog с %s закрыто: %v", sender, err)
+			}
+			return
+		}
+		if raw != "" {
+			l.handle(raw, sender, certNode)
+		}
+	}
+}
+
+// readFrame читает одно сообщение из TCP-потока.
+func (l *Listener) readFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := reader.ReadSlice(' ')
+		if errors.Is(err, io.EOF) {
+			return "", io.ErrUnexpectedEOF // Соединение закрыто посреди длины сообщения
+		}
+		if err != nil {
+			return "", err
+		}
+		length, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+		if err != nil || length > l.cfg.SyslogMaxMessageSize {
+			return "", fmt.Errorf("некорректная длина сообщения '%s'", strings.TrimSpace(string(prefix)))
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return "", err
+		}
+		return string(frame), nil
+	}
+
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("сообщение длиннее %d байт", l.cfg.SyslogMaxMessageSize)
+	}
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// handle разбирает одно сообщение и добавляет запись Xray в текущую пачку.
+// Сообщения, не являющиеся строками access.log, пропускаются.
+func (l *Listener) handle(raw string, sender netip.Addr, certNode string) {
+	msg, err := ParseMessage(raw)
+	if err != nil {
+		return
+	}
+	entry, ok := ParseXrayLine(msg.Content)
+	if !ok {
+		return
+	}
+	entry.NodeID = l.nodeID(sender, certNode)
+
+	l.mu.Lock()
+	l.batch = append(l.batch, entry)
+	full := len(l.batch) >= l.cfg.SyslogBatchSize
+	l.mu.Unlock()
+
+	if full {
+		l.flush()
+	}
+}
+
+// nodeID определяет ноду-отправителя: сначала по CN клиентского сертификата (единственное,
+// что подтверждает отправителя), затем по SYSLOG_NODES (адрес отправителя) и, наконец,
+// по самому адресу. HOSTNAME из заголовка syslog не используется: его задает сам отправитель.
+func (l *Listener) nodeID(sender netip.Addr, certNode string) string {
+	if certNode != "" {
+		return certNode
+	}
+	if node, ok := l.cfg.SyslogNodes[sender.String()]; ok {
+		return node
+	}
+	return sender.String()
+}
+
+// flush передает накопленные записи в обработчик. Если очередь шарда заполнена,
+// записи этого шарда отбрасываются: у syslog нет способа попросить отправителя повторить.
+func (l *Listener) flush() {
+	l.mu.Lock()
+	entries := l.batch
+	l.batch = nil
+	l.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	if err := l.processor.EnqueueEntries(entries); err != nil {
+		dropped := len(entries)
+		var bp *processor.BackpressureError
+		if errors.As(err, &bp) {
+			dropped = bp.Rejected
+		}
+		log.Printf("Warning: очереди шардов заполнены, отброшено %d записей syslog: %v", dropped, err)
+	}
+}
+
+func (l *Listener) isAllowed(sender netip.Addr) bool {
+	if len(l.allowed) == 0 {
+		return true
+	}
+	for _, prefix := range l.allowed {
+		if prefix.Contains(sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrOf возвращает IP-адрес отправителя без порта.
+func addrOf(addr net.Addr) netip.Addr {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.AddrPort().Addr().Unmap()
+	case *net.TCPAddr:
+		return a.AddrPort().Addr().Unmap()
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
@@ -0,0 +1,250 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"observer_service/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMaxMessageSize — небольшой лимит, чтобы проверять слишком длинные сообщения.
+const testMaxMessageSize = 64
+
+func newTestListener(nodes map[string]string) *Listener {
+	return &Listener{cfg: &config.Config{
+		SyslogNodes:          nodes,
+		SyslogBatchSize:      1000,
+		SyslogMaxMessageSize: testMaxMessageSize,
+	}}
+}
+
+// readFrames читает сообщения из потока, пока readFrame не вернет ошибку.
+func readFrames(l *Listener, stream string) ([]string, error) {
+	reader := bufio.NewReaderSize(strings.NewReader(stream), l.cfg.SyslogMaxMessageSize)
+	var frames []string
+	for {
+		frame, err := l.readFrame(reader)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	long := strings.Repeat("x", testMaxMessageSize+1)
+
+	tests := []struct {
+		name    string
+		stream  string
+		want    []string
+		wantErr error // nil — любая ошибка, кроме io.EOF
+		eof     bool
+	}{
+		{
+			name:   "octet counting",
+			stream: "5 <13>a11 <13>1 - - x",
+			want:   []string{"<13>a", "<13>1 - - x"},
+			eof:    true,
+		},
+		{
+			name:   "octet counting с переводом строки внутри сообщения",
+			stream: "9 <13>a\nb\nc",
+			want:   []string{"<13>a\nb\nc"},
+			eof:    true,
+		},
+		{
+			name:   "перевод строки",
+			stream: "<13>a\n<13>b\r\n<13>c",
+			want:   []string{"<13>a", "<13>b", "<13>c"},
+			eof:    true,
+		},
+		{
+			name:   "пустые строки",
+			stream: "<13>a\n\n<13>b\n",
+			want:   []string{"<13>a", "", "<13>b"},
+			eof:    true,
+		},
+		{
+			name:   "оба способа в одном соединении",
+			stream: "5 <13>a<13>b\n5 <13>c",
+			want:   []string{"<13>a", "<13>b", "<13>c"},
+			eof:    true,
+		},
+		{
+			name:    "обрезанное сообщение с длиной",
+			stream:  "10 <13>a",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "обрезанная длина",
+			stream:  "12",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "длина не число",
+			stream: "1a <13>a",
+		},
+		{
+			name:   "длина больше SYSLOG_MAX_MESSAGE_SIZE",
+			stream: "65 " + long,
+		},
+		{
+			name:   "строка длиннее SYSLOG_MAX_MESSAGE_SIZE",
+			stream: long + "\n",
+		},
+		{
+			name:   "сообщение ровно SYSLOG_MAX_MESSAGE_SIZE",
+			stream: "64 " + long[:testMaxMessageSize],
+			want:   []string{long[:testMaxMessageSize]},
+			eof:    true,
+		},
+	}
+
+	l := newTestListener(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := readFrames(l, tt.stream)
+			if !reflect.DeepEqual(frames, tt.want) {
+				t.Fatalf("прочитано %q, ожидалось %q", frames, tt.want)
+			}
+			switch {
+			case tt.eof:
+				if !errors.Is(err, io.EOF) {
+					t.Fatalf("ошибка %v, ожидался конец потока", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ошибка %v, ожидалось %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, io.EOF) {
+					t.Fatalf("ошибка %v, ожидалась ошибка формата", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	const xrayLine = "2025/01/02 15:04:05 from tcp:[2001:db8::7]:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com"
+	ipv6Sender := netip.MustParseAddr("2001:db8::10")
+	ipv4Sender := netip.MustParseAddr("198.51.100.10")
+
+	tests := []struct {
+		name     string
+		raw      string
+		sender   netip.Addr
+		certNode string
+		nodes    map[string]string
+		wantNode string
+		skipped  bool
+	}{
+		{
+			name:     "IPv6-отправитель без SYSLOG_NODES",
+			raw:      "<14>Oct 11 22:14:15 spoofed-host xray: " + xrayLine,
+			sender:   ipv6Sender,
+			wantNode: "2001:db8::10",
+		},
+		{
+			name:     "IPv6-отправитель из SYSLOG_NODES",
+			raw:      "<165>1 2025-01-02T15:04:05Z spoofed-host xray - - - " + xrayLine,
+			sender:   ipv6Sender,
+			nodes:    map[string]string{"2001:db8::10": "node-v6"},
+			wantNode: "node-v6",
+		},
+		{
+			name:     "CN сертификата важнее SYSLOG_NODES",
+			raw:      "<14>Oct 11 22:14:15 xray: " + xrayLine,
+			sender:   ipv4Sender,
+			certNode: "node-cert",
+			nodes:    map[string]string{"198.51.100.10": "node-v4"},
+			wantNode: "node-cert",
+		},
+		{
+			name:    "не строка access.log",
+			raw:     "<14>Oct 11 22:14:15 node-1 xray: [Info] core: Xray started",
+			sender:  ipv4Sender,
+			skipped: true,
+		},
+		{
+			name:    "некорректный PRI",
+			raw:     "<x>Oct 11 22:14:15 node-1 xray: " + xrayLine,
+			sender:  ipv4Sender,
+			skipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestListener(tt.nodes)
+			l.handle(tt.raw, tt.sender, tt.certNode)
+
+			if tt.skipped {
+				if len(l.batch) != 0 {
+					t.Fatalf("сообщение должно быть пропущено, в пачке %+v", l.batch)
+				}
+				return
+			}
+			if len(l.batch) != 1 {
+				t.Fatalf("в пачке %d записей, ожидалась 1", len(l.batch))
+			}
+			entry := l.batch[0]
+			if entry.SourceIP != "2001:db8::7" || entry.UserEmail != "user@example.com" || entry.NodeID != tt.wantNode {
+				t.Fatalf("получено {ip=%s email=%s node=%s}, ожидалось {ip=2001:db8::7 email=user@example.com node=%s}",
+					entry.SourceIP, entry.UserEmail, entry.NodeID, tt.wantNode)
+			}
+		})
+	}
+}
+
+func TestAddrOf(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{addr: &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 514}, want: "203.0.113.7"},
+		{addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 514}, want: "2001:db8::1"},
+		{addr: &net.TCPAddr{IP: net.ParseIP("::ffff:203.0.113.7"), Port: 6514}, want: "203.0.113.7"},
+		{addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6514}, want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		if got := addrOf(tt.addr).String(); got != tt.want {
+			t.Errorf("addrOf(%v) = %s, ожидалось %s", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	l := newTestListener(nil)
+	for _, item := range []string{"198.51.100.0/24", "2001:db8::10", "::ffff:203.0.113.7"} {
+		prefix, err := parsePrefix(item)
+		if err != nil {
+			t.Fatalf("parsePrefix(%q): %v", item, err)
+		}
+		l.allowed = append(l.allowed, prefix)
+	}
+
+	tests := []struct {
+		sender string
+		want   bool
+	}{
+		{sender: "198.51.100.77", want: true},
+		{sender: "198.51.101.1", want: false},
+		{sender: "2001:db8::10", want: true},
+		{sender: "2001:db8::11", want: false},
+		{sender: "203.0.113.7", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := l.isAllowed(netip.MustParseAddr(tt.sender)); got != tt.want {
+			t.Errorf("isAllowed(%s) = %v, ожидалось %v", tt.sender, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package syslog
+
+import (
+	"errors"
+	"net/netip"
+	"observer_service/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message — разобранное syslog-сообщение: имя хоста отправителя и текст сообщения.
+type Message struct {
+	Hostname string
+	AppName  string
+	Content  string
+}
+
+var errNoPriority = errors.New("сообщение не начинается с <PRI>")
+
+// ParseMessage разбирает сообщение в формате RFC 5424 или RFC 3164 (BSD syslog).
+// Для RFC 3164 поддерживаются варианты без имени хоста и с временем в формате RFC 3339,
+// которые отправляют rsyslog и journald.
+func ParseMessage(raw string) (Message, error) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	if !strings.HasPrefix(raw, "<") {
+		return Message{}, errNoPriority
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return Message{}, errNoPriority
+	}
+	if _, err := strconv.Atoi(raw[1:end]); err != nil {
+		return Message{}, errNoPriority
+	}
+	rest := raw[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424(rest[2:])
+	}
+	return parseRFC3164(rest), nil
+}
+
+// parseRFC5424 разбирает часть сообщения после "<PRI>1 ":
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+func parseRFC5424(rest string) (Message, error) {
+	var fields [5]string
+	for i := range fields {
+		field, tail, found := strings.Cut(rest, " ")
+		if !found {
+			return Message{}, errors.New("неполный заголовок RFC 5424")
+		}
+		fields[i], rest = field, tail
+	}
+
+	content, err := skipStructuredData(rest)
+	if err != nil {
+		return Message{}, err
+	}
+	content = strings.TrimPrefix(content, "\ufeff") // BOM перед UTF-8 текстом
+
+	return Message{
+		Hostname: nilValue(fields[1]),
+		AppName:  nilValue(fields[2]),
+		Content:  content,
+	}, nil
+}
+
+// skipStructuredData пропускает STRUCTURED-DATA ("-" или набор [id param="value"...])
+// и возвращает текст сообщения.
+func skipStructuredData(rest string) (string, error) {
+	if strings.HasPrefix(rest, "-") {
+		return strings.TrimPrefix(rest[1:], " "), nil
+	}
+
+	inQuotes := false
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == '\\' && inQuotes:
+			i++ // Экранированный символ внутри значения параметра
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ']' && !inQuotes:
+			if i+1 < len(rest) && rest[i+1] == '[' {
+				continue
+			}
+			return strings.TrimPrefix(rest[i+1:], " "), nil
+		}
+	}
+	return "", errors.New("незакрытый блок STRUCTURED-DATA")
+}
+
+// parseRFC3164 разбирает часть сообщения после "<PRI>": [TIMESTAMP] [HOSTNAME] [TAG:] MSG.
+func parseRFC3164(rest string) Message {
+	if len(rest) > len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err == nil {
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	if token, tail, found := strings.Cut(rest, " "); found {
+		if _, err := time.Parse(time.RFC3339Nano, token); err == nil {
+			rest = tail
+		}
+	}
+
+	var msg Message
+	if token, tail, found := strings.Cut(rest, " "); found && !isTag(token) {
+		msg.Hostname, rest = token, tail
+	}
+	if token, tail, found := strings.Cut(rest, " "); found && isTag(token) {
+		msg.AppName, rest = token[:strings.IndexAny(token, "[:")], tail
+	}
+	msg.Content = rest
+	return msg
+}
+
+// isTag сообщает, похоже ли слово на TAG вида "xray:" или "xray[123]:".
+func isTag(token string) bool {
+	return strings.HasSuffix(token, ":") && strings.IndexAny(token, "[:") > 0
+}
+
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// ParseXrayLine разбирает строку access.log Xray и извлекает адрес клиента и email пользователя.
+// Поддерживаются IPv4 и IPv6 (в квадратных скобках), с префиксом сети и без него, например:
+//
+//	2025/01/02 15:04:05.123456 from 203.0.113.7:51234 accepted tcp:example.com:443 [in -> out] email: user@example.com
+//	2025/01/02 15:04:05 from tcp:[2001:db8::1]:51234 accepted udp:1.1.1.1:53 [in >> out] email: 42
+//
+// Строки без адреса клиента или email возвращают ok == false. IPv4-mapped IPv6 приводится к IPv4.
+func ParseXrayLine(line string) (entry models.LogEntry, ok bool) {
+	fromIdx := strings.Index(line, " from ")
+	if fromIdx < 0 {
+		return entry, false
+	}
+	rest := line[fromIdx+len(" from "):]
+	source, _, _ := strings.Cut(rest, " ")
+
+	ip, ok := parseSource(source)
+	if !ok {
+		return entry, false
+	}
+
+	emailIdx := strings.LastIndex(rest, " email: ")
+	if emailIdx < 0 {
+		return entry, false
+	}
+	email, _, _ := strings.Cut(strings.TrimSpace(rest[emailIdx+len(" email: "):]), " ")
+	if email == "" {
+		return entry, false
+	}
+	return models.LogEntry{UserEmail: email, SourceIP: ip}, true
+}
+
+// parseSource разбирает адрес источника вида [tcp:|udp:]host:port и возвращает канонический IP.
+func parseSource(source string) (string, bool) {
+	if network, addr, found := strings.Cut(source, ":"); found && (network == "tcp" || network == "udp") {
+		source = addr
+	}
+
+	var host string
+	if strings.HasPrefix(source, "[") {
+		end := strings.Index(source, "]")
+		if end < 0 {
+			return "", false
+		}
+		host = source[1:end]
+	} else {
+		idx := strings.LastIndex(source, ":")
+		if idx < 0 {
+			return "", false
+		}
+		host = source[:idx]
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil || ip.Zone() != "" {
+		return "", false
+	}
+	return ip.Unmap().String(), true
+}
@@ -0,0 +1,142 @@
+package syslog
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "RFC 5424",
+			raw:  "<165>1 2025-01-02T15:04:05.003Z node-1 xray 123 ID47 - accepted",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 5424 со STRUCTURED-DATA",
+			raw:  `<165>1 2025-01-02T15:04:05Z node-1 xray - - [meta@32473 a="1" b="x\"]y"][origin ip="203.0.113.1"] accepted`,
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 5424 с BOM",
+			raw:  "<165>1 2025-01-02T15:04:05Z node-1 xray - - - \ufeffaccepted",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 5424 с пустыми полями",
+			raw:  "<13>1 - - - - - - accepted",
+			want: Message{Content: "accepted"},
+		},
+		{
+			name: "RFC 5424 без текста",
+			raw:  "<13>1 2025-01-02T15:04:05Z node-1 xray - - -",
+			want: Message{Hostname: "node-1", AppName: "xray"},
+		},
+		{
+			name: "RFC 5424 с переводом строки и NUL в конце",
+			raw:  "<13>1 2025-01-02T15:04:05Z node-1 xray - - - accepted\r\n\x00",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{name: "RFC 5424 с неполным заголовком", raw: "<13>1 2025-01-02T15:04:05Z node-1 xray", wantErr: true},
+		{name: "RFC 5424 с незакрытым STRUCTURED-DATA", raw: `<13>1 2025-01-02T15:04:05Z node-1 xray - - [meta a="1"`, wantErr: true},
+		{
+			name: "RFC 3164",
+			raw:  "<34>Oct 11 22:14:15 node-1 xray: accepted",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 3164 с PID в теге",
+			raw:  "<34>Oct  1 22:14:15 node-1 xray[123]: accepted",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 3164 без имени хоста",
+			raw:  "<14>Oct 11 22:14:15 xray: accepted",
+			want: Message{AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 3164 со временем RFC 3339",
+			raw:  "<14>2025-01-02T15:04:05.123+03:00 node-1 xray: accepted",
+			want: Message{Hostname: "node-1", AppName: "xray", Content: "accepted"},
+		},
+		{
+			name: "RFC 3164 без заголовка",
+			raw:  "<14>accepted",
+			want: Message{Content: "accepted"},
+		},
+		{name: "без PRI", raw: "Oct 11 22:14:15 node-1 xray: accepted", wantErr: true},
+		{name: "пустой PRI", raw: "<>1 - - - - - - accepted", wantErr: true},
+		{name: "PRI не число", raw: "<ab>1 - - - - - - accepted", wantErr: true},
+		{name: "слишком длинный PRI", raw: "<1234>1 - - - - - - accepted", wantErr: true},
+		{name: "незакрытый PRI", raw: "<13 accepted", wantErr: true},
+		{name: "пустое сообщение", raw: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMessage(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMessage = %+v, ожидалась ошибка", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMessage: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseMessage = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseMessage("accepted"); !errors.Is(err, errNoPriority) {
+		t.Fatalf("ParseMessage без PRI = %v, ожидалось %v", err, errNoPriority)
+	}
+}
+
+// accessLogFixture — пример строки access.log Xray. Одни и те же примеры в testdata/ проверяют
+// разбор и в observer, и в агенте блокировщика, чтобы парсеры не расходились.
+type accessLogFixture struct {
+	Name  string `json:"name"`
+	Line  string `json:"line"`
+	OK    bool   `json:"ok"`
+	IP    string `json:"ip"`
+	Email string `json:"email"`
+}
+
+func loadAccessLogFixtures(t *testing.T) []accessLogFixture {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", "testdata", "xray_access_log.json"))
+	if err != nil {
+		t.Fatalf("не удалось прочитать примеры access.log: %v", err)
+	}
+	var fixtures []accessLogFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatalf("некорректный файл примеров access.log: %v", err)
+	}
+	return fixtures
+}
+
+func TestParseXrayLine(t *testing.T) {
+	for _, tt := range loadAccessLogFixtures(t) {
+		t.Run(tt.Name, func(t *testing.T) {
+			entry, ok := ParseXrayLine(tt.Line)
+			if ok != tt.OK {
+				t.Fatalf("ok = %v, ожидалось %v (запись %+v)", ok, tt.OK, entry)
+			}
+			if ok && (entry.SourceIP != tt.IP || entry.UserEmail != tt.Email) {
+				t.Errorf("получено {ip=%s email=%s}, ожидалось {ip=%s email=%s}",
+					entry.SourceIP, entry.UserEmail, tt.IP, tt.Email)
+			}
+		})
+	}
+}